@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+type variant struct {
+	Name    string
+	Type    string // Name, or *Name for pointer receivers
+	Exposed string // Name with an upper case first letter
+}
+
+type sumType struct {
+	Package   string
+	Interface string
+	Exposed   string
+	Format    string
+	Variants  []variant
+}
+
+// Func unexports the generated functions of an unexported interface.
+func (s sumType) Func(name string) string {
+	if ast.IsExported(s.Interface) {
+		return name
+	}
+	return string(unicode.ToLower(rune(name[0]))) + name[1:]
+}
+
+func generate(dir, interfaceName, payloadFormat string) ([]byte, error) {
+	if payloadFormat != "json" && payloadFormat != "gob" {
+		return nil, fmt.Errorf("unknown codec %q", payloadFormat)
+	}
+	files, err := parsePackage(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	markers, err := markerMethods(files, interfaceName)
+	if err != nil {
+		return nil, err
+	}
+	variants := implementers(files, markers)
+	if len(variants) == 0 {
+		return nil, fmt.Errorf("no type implements %s", interfaceName)
+	}
+
+	s := sumType{
+		Package:   files[0].Name.Name,
+		Interface: interfaceName,
+		Exposed:   exposed(interfaceName),
+		Format:    map[string]string{"json": "JSON", "gob": "Gob"}[payloadFormat],
+		Variants:  variants,
+	}
+	var buffer bytes.Buffer
+	if err := sumTypeTemplate.Execute(&buffer, s); err != nil {
+		return nil, err
+	}
+	return format.Source(buffer.Bytes())
+}
+
+func parsePackage(dir string) ([]*ast.File, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") || strings.HasSuffix(name, "_gen.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no Go file in %s", dir)
+	}
+	return files, nil
+}
+
+// markerMethods returns the methods of the interface without parameters nor results: the
+// types of the sum type are the ones implementing all of them.
+func markerMethods(files []*ast.File, interfaceName string) ([]string, error) {
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			spec, ok := typeSpec(decl, interfaceName)
+			if !ok {
+				continue
+			}
+			iface, ok := spec.Type.(*ast.InterfaceType)
+			if !ok {
+				return nil, fmt.Errorf("%s is not an interface", interfaceName)
+			}
+			var markers []string
+			for _, method := range iface.Methods.List {
+				signature, ok := method.Type.(*ast.FuncType)
+				if ok && len(method.Names) == 1 && signature.Params.NumFields() == 0 && signature.Results.NumFields() == 0 {
+					markers = append(markers, method.Names[0].Name)
+				}
+			}
+			if len(markers) == 0 {
+				return nil, fmt.Errorf("%s has no marker method", interfaceName)
+			}
+			return markers, nil
+		}
+	}
+	return nil, errors.New("interface " + interfaceName + " not found")
+}
+
+func typeSpec(decl ast.Decl, name string) (*ast.TypeSpec, bool) {
+	gen, ok := decl.(*ast.GenDecl)
+	if !ok || gen.Tok != token.TYPE {
+		return nil, false
+	}
+	for _, spec := range gen.Specs {
+		if spec := spec.(*ast.TypeSpec); spec.Name.Name == name {
+			return spec, true
+		}
+	}
+	return nil, false
+}
+
+func implementers(files []*ast.File, markers []string) []variant {
+	methods := make(map[string]map[string]bool)
+	pointers := make(map[string]bool)
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv == nil || len(fn.Recv.List) != 1 {
+				continue
+			}
+			receiver := fn.Recv.List[0].Type
+			if star, ok := receiver.(*ast.StarExpr); ok {
+				receiver = star.X
+				if ident, ok := receiver.(*ast.Ident); ok {
+					pointers[ident.Name] = true
+				}
+			}
+			ident, ok := receiver.(*ast.Ident)
+			if !ok {
+				continue
+			}
+			if methods[ident.Name] == nil {
+				methods[ident.Name] = make(map[string]bool)
+			}
+			methods[ident.Name][fn.Name.Name] = true
+		}
+	}
+
+	var variants []variant
+	for name, implemented := range methods {
+		all := true
+		for _, marker := range markers {
+			all = all && implemented[marker]
+		}
+		if !all {
+			continue
+		}
+		v := variant{Name: name, Type: name, Exposed: exposed(name)}
+		if pointers[name] {
+			v.Type = "*" + name
+		}
+		variants = append(variants, v)
+	}
+	sort.Slice(variants, func(i, j int) bool { return variants[i].Name < variants[j].Name })
+	return variants
+}
+
+func exposed(name string) string {
+	return string(unicode.ToUpper(rune(name[0]))) + name[1:]
+}
+
+var sumTypeTemplate = template.Must(template.New("sumType").Parse(`// Code generated by eventgen; DO NOT EDIT.
+
+package {{.Package}}
+
+import "github.com/nbarbey/go-event-store/eventstore/codec"
+
+const (
+{{- range .Variants}}
+	{{.Name}}Type = "{{.Name}}"
+{{- end}}
+)
+
+func {{.Func "New"}}{{.Exposed}}UnmarshallerMap() codec.UnmarshallerMap[{{.Interface}}] {
+	return codec.NewUnmarshallerMap[{{.Interface}}](){{range .Variants}}.
+		AddFunc({{.Name}}Type, func(payload []byte) ({{$.Interface}}, error) {
+			return codec.Build{{$.Format}}UnmarshalFunc[{{.Type}}]()(payload)
+		}){{end}}
+}
+
+func {{.Func "Register"}}{{.Exposed}}Types() {
+{{- range .Variants}}
+	codec.Register[{{$.Interface}}, {{.Type}}]({{.Name}}Type)
+{{- end}}
+}
+
+type {{.Interface}}Visitor interface {
+{{- range .Variants}}
+	Visit{{.Exposed}}(event {{.Type}})
+{{- end}}
+}
+
+func {{.Func "Visit"}}{{.Exposed}}(event {{.Interface}}, visitor {{.Interface}}Visitor) {
+	switch event := event.(type) {
+{{- range .Variants}}
+	case {{.Type}}:
+		visitor.Visit{{.Exposed}}(event)
+{{- end}}
+	}
+}
+`))
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	t.Run("generate the codec of a sum type", func(t *testing.T) {
+		expected, err := os.ReadFile("testdata/shop/orderevent_gen.go")
+		require.NoError(t, err)
+
+		source, err := generate("testdata/shop", "OrderEvent", "json")
+		require.NoError(t, err)
+
+		assert.Equal(t, string(expected), string(source))
+	})
+
+	t.Run("gob payloads", func(t *testing.T) {
+		source, err := generate("testdata/shop", "OrderEvent", "gob")
+		require.NoError(t, err)
+
+		assert.Contains(t, string(source), "codec.BuildGobUnmarshalFunc[OrderPlaced]()")
+	})
+
+	t.Run("unexported interface", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "todo.go"), []byte(`package todo
+
+type todoEvent interface{ isTodoEvent() }
+
+type todoDone struct{}
+
+func (todoDone) isTodoEvent() {}
+`), 0o644))
+
+		source, err := generate(dir, "todoEvent", "json")
+		require.NoError(t, err)
+
+		assert.Contains(t, string(source), "func newTodoEventUnmarshallerMap() codec.UnmarshallerMap[todoEvent]")
+		assert.Contains(t, string(source), "func registerTodoEventTypes()")
+		assert.Contains(t, string(source), "func visitTodoEvent(event todoEvent, visitor todoEventVisitor)")
+		assert.Contains(t, string(source), "VisitTodoDone(event todoDone)")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := generate("testdata/shop", "PaymentEvent", "json")
+		assert.ErrorContains(t, err, "interface PaymentEvent not found")
+		_, err = generate("testdata/shop", "Customer", "json")
+		assert.ErrorContains(t, err, "Customer is not an interface")
+		_, err = generate("testdata/shop", "OrderEvent", "xml")
+		assert.ErrorContains(t, err, `unknown codec "xml"`)
+	})
+}
@@ -0,0 +1,43 @@
+// Command eventgen generates the codec boilerplate of a sum type of events: the types of
+// a package implementing the marker methods of an event interface get a type hint
+// constant, an UnmarshallerMap entry, a registration and a case in an exhaustive visitor.
+//
+//	//go:generate go run github.com/nbarbey/go-event-store/cmd/eventgen -type AccountEvent
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	typeName := flag.String("type", "", "name of the event interface")
+	format := flag.String("codec", "json", "payload format of the generated UnmarshallerMap: json or gob")
+	output := flag.String("output", "", "output file name; default <type>_gen.go")
+	flag.Parse()
+	log.SetFlags(0)
+	log.SetPrefix("eventgen: ")
+
+	if *typeName == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	dir := "."
+	if args := flag.Args(); len(args) > 0 {
+		dir = args[0]
+	}
+	if *output == "" {
+		*output = strings.ToLower(*typeName) + "_gen.go"
+	}
+
+	source, err := generate(dir, *typeName, *format)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, *output), source, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
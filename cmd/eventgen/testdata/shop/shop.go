@@ -0,0 +1,21 @@
+package shop
+
+type OrderEvent interface {
+	isOrderEvent()
+}
+
+type OrderPlaced struct {
+	Items int
+}
+
+func (OrderPlaced) isOrderEvent() {}
+
+type OrderCancelled struct {
+	Reason string
+}
+
+func (*OrderCancelled) isOrderEvent() {}
+
+type Customer struct {
+	Name string
+}
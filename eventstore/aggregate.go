@@ -0,0 +1,150 @@
+package eventstore
+
+import (
+	"context"
+	"github.com/beevik/guid"
+	"github.com/nbarbey/go-event-store/eventstore/repository"
+)
+
+type Aggregate[S any, E any] struct {
+	ID       string
+	State    S
+	Revision string
+	Position int64
+	pending  []E
+	apply    func(S, E) S
+
+	eventsSinceSnapshot int
+}
+
+// Raise applies the event to the state and keeps it until the aggregate is saved.
+func (a *Aggregate[S, E]) Raise(events ...E) {
+	for _, event := range events {
+		a.State = a.apply(a.State, event)
+		a.pending = append(a.pending, event)
+	}
+}
+
+func (a *Aggregate[S, E]) Pending() []E {
+	return a.pending
+}
+
+type AggregateRepository[S any, E any] struct {
+	category  string
+	apply     func(S, E) S
+	typeHint  func(E) string
+	snapshots *snapshotter[S]
+	*repository.TypedRepository[E]
+}
+
+// NewAggregateRepository stores each aggregate in its own stream, named after the category
+// and the aggregate id, so that all aggregates can be read through the category stream.
+func NewAggregateRepository[S any, E any](es *EventStore[E], category string, apply func(S, E) S) *AggregateRepository[S, E] {
+	return &AggregateRepository[S, E]{
+		category:        category,
+		apply:           apply,
+		typeHint:        func(E) string { return "" },
+		TypedRepository: es.Listener.TypedRepository,
+	}
+}
+
+func (ar *AggregateRepository[S, E]) WithTypeHints(typeHint func(E) string) *AggregateRepository[S, E] {
+	return &AggregateRepository[S, E]{
+		category:        ar.category,
+		apply:           ar.apply,
+		typeHint:        typeHint,
+		snapshots:       ar.snapshots,
+		TypedRepository: ar.TypedRepository,
+	}
+}
+
+func (ar *AggregateRepository[S, E]) StreamName(id string) string {
+	return ar.category + "-" + id
+}
+
+func (ar *AggregateRepository[S, E]) New(id string) *Aggregate[S, E] {
+	return &Aggregate[S, E]{ID: id, apply: ar.apply}
+}
+
+func (ar *AggregateRepository[S, E]) Load(ctx context.Context, id string) (*Aggregate[S, E], error) {
+	aggregate := ar.New(id)
+	if ar.snapshots != nil {
+		err := ar.snapshots.restore(ctx, ar.StreamName(id), &aggregate.State, &aggregate.Revision, &aggregate.Position)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := aggregate.fold(ctx, ar.Stream(ar.StreamName(id)))
+	if err != nil {
+		return nil, err
+	}
+	return aggregate, nil
+}
+
+// Save appends the pending events at once, expecting the stream to still be at the revision
+// the aggregate was loaded at, or not to exist yet for a new aggregate. It fails with
+// repository.ErrVersionMismatch otherwise, and then appends none of them.
+func (ar *AggregateRepository[S, E]) Save(ctx context.Context, aggregate *Aggregate[S, E]) error {
+	if len(aggregate.pending) == 0 {
+		return nil
+	}
+	err := aggregate.commit(ctx, ar.Stream(ar.StreamName(aggregate.ID)), ar.typeHint)
+	if err != nil {
+		return err
+	}
+
+	if ar.snapshots != nil && ar.snapshots.policy.ShouldSnapshot(aggregate.eventsSinceSnapshot) {
+		// the events are saved: failing now would have callers save them twice
+		if ar.snapshots.take(ctx, ar.StreamName(aggregate.ID), aggregate.State, aggregate.Revision, aggregate.Position) == nil {
+			aggregate.eventsSinceSnapshot = 0
+		}
+	}
+	return nil
+}
+
+// fold applies the events of the stream that follow the position of the aggregate.
+func (a *Aggregate[S, E]) fold(ctx context.Context, stream *repository.TypedRepository[E]) error {
+	envelopes, lastPosition, err := stream.ReadEnvelopePage(ctx, a.Position+1, 0)
+	if err != nil {
+		return err
+	}
+	for _, envelope := range envelopes {
+		a.State = a.apply(a.State, envelope.Event)
+		a.Revision = envelope.Version
+		a.Position = envelope.Position
+		a.eventsSinceSnapshot++
+	}
+	if lastPosition > a.Position {
+		// the stream ends with skipped events: the aggregate is at their revision all the same
+		raws, err := stream.ReadRawEvents(ctx, lastPosition, 1)
+		if err != nil {
+			return err
+		}
+		if len(raws) > 0 {
+			a.Revision, a.Position = raws[0].Version, raws[0].Position
+		}
+	}
+	return nil
+}
+
+// commit appends the pending events to the stream in a single append, expecting the stream
+// not to exist yet when the aggregate has never been saved.
+func (a *Aggregate[S, E]) commit(ctx context.Context, stream *repository.TypedRepository[E], typeHint func(E) string) error {
+	pending := make([]repository.PendingEvent[E], 0, len(a.pending))
+	for _, event := range a.pending {
+		pending = append(pending, repository.PendingEvent[E]{Version: guid.New().String(), TypeHint: typeHint(event), Event: event})
+	}
+	expectedVersion := a.Revision
+	if a.Position == 0 {
+		expectedVersion = repository.NoStream
+	}
+	inserted, err := stream.InsertEvents(ctx, pending, expectedVersion)
+	if err != nil {
+		return err
+	}
+	last := inserted[len(inserted)-1]
+	a.Revision, a.Position = last.Version, last.Position
+	a.pending = nil
+	a.eventsSinceSnapshot += len(inserted)
+	return nil
+}
@@ -11,3 +11,17 @@ type Codec[E any] interface {
 	Marshaller[E]
 	Unmarshaller[E]
 }
+
+// StreamMarshaller encodes events knowing the stream they are appended to, for instance to
+// encrypt them with the key of the stream.
+type StreamMarshaller[E any] interface {
+	MarshallToStream(stream string, event E) ([]byte, error)
+}
+
+// MarshallToStream encodes event with c, telling it the stream when c is a StreamMarshaller.
+func MarshallToStream[E any](c Marshaller[E], stream string, event E) ([]byte, error) {
+	if marshaller, ok := c.(StreamMarshaller[E]); ok {
+		return marshaller.MarshallToStream(stream, event)
+	}
+	return c.Marshall(event)
+}
@@ -0,0 +1,54 @@
+package codec
+
+import (
+	"github.com/fxamacker/cbor/v2"
+)
+
+// Times are encoded as RFC 3339 strings rather than CBOR's default of whole seconds,
+// so that they keep their nanoseconds.
+var cborEncoding, _ = cbor.EncOptions{Time: cbor.TimeRFC3339Nano}.EncMode()
+var cborDecoding, _ = cbor.DecOptions{}.DecMode()
+
+func NewCBORCodec[E any]() *CBORCodec[E] {
+	return &CBORCodec[E]{}
+}
+
+// CBORCodec encodes events in CBOR (RFC 8949): like JSON it needs no schema and is read
+// in most languages, but its payloads are binary and smaller.
+type CBORCodec[E any] struct{}
+
+func (CBORCodec[E]) Marshall(event E) ([]byte, error) {
+	return cborEncoding.Marshal(event)
+}
+
+func (CBORCodec[E]) Unmarshall(payload []byte) (event E, err error) {
+	err = cborDecoding.Unmarshal(payload, &event)
+	return event, err
+}
+
+func (CBORCodec[E]) ContentType() string {
+	return ContentTypeCBOR
+}
+
+type CBORCodecWithTypeHints[E any] struct {
+	CBORCodec[E]
+	*UnmarshalerWithTypeHint[E]
+}
+
+func NewCBORCodecWithTypeHints[E any](unmarshalers UnmarshallerMap[E]) *CBORCodecWithTypeHints[E] {
+	unmarshaler := NewUnmarshalerWithTypeHints[E](CBORCodec[E]{}, unmarshalers)
+	unmarshaler.registered = cborDecoding.Unmarshal
+	return &CBORCodecWithTypeHints[E]{UnmarshalerWithTypeHint: unmarshaler}
+}
+
+func (c *CBORCodecWithTypeHints[E]) WithUnknownTypePolicy(policy UnknownTypePolicy) *CBORCodecWithTypeHints[E] {
+	c.SetUnknownTypePolicy(policy)
+	return c
+}
+
+func BuildCBORUnmarshalFunc[E any]() UnmarshalerFunc[E] {
+	c := NewCBORCodec[E]()
+	return func(payload []byte) (event E, err error) {
+		return c.Unmarshall(payload)
+	}
+}
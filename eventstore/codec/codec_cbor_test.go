@@ -0,0 +1,63 @@
+package codec_test
+
+import (
+	"github.com/nbarbey/go-event-store/eventstore/codec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCBORCodec_Marshall_Unmarshall(t *testing.T) {
+	testCodecMarshalUnmarshal(t, codec.NewCBORCodec[carSold]())
+}
+
+func TestCBORCodec_Marshall_UnmarshallWithType(t *testing.T) {
+	testCodecMarshalUnmarshalWithType(t, codec.NewCBORCodecWithTypeHints[carEvent](codec.NewUnmarshallerMap[carEvent]().
+		AddFunc("carSold", func(payload []byte) (event carEvent, err error) {
+			return codec.BuildCBORUnmarshalFunc[carSold]()(payload)
+		}).
+		AddFunc("carRepaired", func(payload []byte) (event carEvent, err error) {
+			return codec.BuildCBORUnmarshalFunc[carRepaired]()(payload)
+		})))
+}
+
+func TestCBORCodec_keeps_large_events(t *testing.T) {
+	c := codec.NewCBORCodec[largeEvent]()
+
+	payload, err := c.Marshall(bigBlaBla)
+	require.NoError(t, err)
+	received, err := c.Unmarshall(payload)
+	require.NoError(t, err)
+
+	assert.Equal(t, bigBlaBla, received)
+	json, err := codec.NewJSONCodec[largeEvent]().Marshall(bigBlaBla)
+	require.NoError(t, err)
+	assert.Less(t, len(payload), len(json))
+}
+
+func BenchmarkCBORCodec_Marshall(b *testing.B) {
+	c := codec.NewCBORCodec[carSold]()
+
+	for i := 0; i < b.N; i++ {
+		_, _ = c.Marshall(soldAMercedesForChristmas)
+	}
+}
+
+func BenchmarkCBORCodec_Marshall_big(b *testing.B) {
+	c := codec.NewCBORCodec[largeEvent]()
+
+	var payload []byte
+	for i := 0; i < b.N; i++ {
+		payload, _ = c.Marshall(bigBlaBla)
+	}
+	b.ReportMetric(float64(len(payload)), "payload-bytes")
+}
+
+func BenchmarkCBORCodec_MarshallUnmarshal_big(b *testing.B) {
+	c := codec.NewCBORCodec[largeEvent]()
+
+	for i := 0; i < b.N; i++ {
+		payload, _ := c.Marshall(bigBlaBla)
+		_, _ = c.Unmarshall(payload)
+	}
+}
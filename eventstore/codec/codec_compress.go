@@ -0,0 +1,149 @@
+package codec
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"sync"
+)
+
+type Compression byte
+
+const (
+	Gzip Compression = 'g'
+	Zstd Compression = 'z'
+)
+
+const DefaultCompressionThreshold = 1024
+
+// Compressed payloads start with a zero byte, which no JSON, gob or protobuf payload does,
+// then the compression and the magic number of its format, so that payloads stored before
+// compression was enabled are told apart and decoded as they are.
+const compressionMarker = 0
+
+var compressionMagics = map[Compression][]byte{
+	Gzip: {0x1f, 0x8b},
+	Zstd: {0x28, 0xb5, 0x2f, 0xfd},
+}
+
+var zstdEncoder = sync.OnceValues(func() (*zstd.Encoder, error) { return zstd.NewWriter(nil) })
+var zstdDecoder = sync.OnceValues(func() (*zstd.Decoder, error) { return zstd.NewReader(nil) })
+
+// CompressingCodec compresses the payloads of its inner codec that are at least threshold
+// bytes long. It decodes payloads compressed with any compression, so that the compression
+// can be changed without rewriting events, and hands type hints down to the inner codec.
+type CompressingCodec[E any] struct {
+	inner       Codec[E]
+	compression Compression
+	threshold   int
+}
+
+func NewCompressingCodec[E any](inner Codec[E], compression Compression) *CompressingCodec[E] {
+	return &CompressingCodec[E]{inner: inner, compression: compression, threshold: DefaultCompressionThreshold}
+}
+
+func (c *CompressingCodec[E]) WithThreshold(threshold int) *CompressingCodec[E] {
+	out := *c
+	out.threshold = threshold
+	return &out
+}
+
+func (c *CompressingCodec[E]) Marshall(event E) ([]byte, error) {
+	return c.MarshallToStream("", event)
+}
+
+func (c *CompressingCodec[E]) MarshallToStream(stream string, event E) ([]byte, error) {
+	payload, err := MarshallToStream(c.inner, stream, event)
+	if err != nil || len(payload) < c.threshold {
+		return payload, err
+	}
+	compressed, err := compress(c.compression, payload)
+	if err != nil {
+		return nil, err
+	}
+	if len(compressed) >= len(payload) {
+		return payload, nil
+	}
+	return compressed, nil
+}
+
+func (c *CompressingCodec[E]) Unmarshall(payload []byte) (event E, err error) {
+	payload, err = decompress(payload)
+	if err != nil {
+		return event, err
+	}
+	return c.inner.Unmarshall(payload)
+}
+
+// ContentType is the one of the inner codec: compressed payloads are told apart on their own.
+func (c *CompressingCodec[E]) ContentType() string {
+	return ContentTypeOf(c.inner)
+}
+
+func (c *CompressingCodec[E]) EventTypeHint(event E) string {
+	return EventTypeHintOf(c.inner, event)
+}
+
+func (c *CompressingCodec[E]) UnmarshallWithType(typeHint string, payload []byte) (event E, err error) {
+	typed, ok := c.inner.(TypedUnmarshaller[E])
+	if !ok {
+		return c.Unmarshall(payload)
+	}
+	payload, err = decompress(payload)
+	if err != nil {
+		return event, err
+	}
+	return typed.UnmarshallWithType(typeHint, payload)
+}
+
+func compress(compression Compression, payload []byte) ([]byte, error) {
+	out := []byte{compressionMarker, byte(compression)}
+	switch compression {
+	case Gzip:
+		buffer := bytes.NewBuffer(out)
+		writer := gzip.NewWriter(buffer)
+		if _, err := writer.Write(payload); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		return buffer.Bytes(), nil
+	case Zstd:
+		encoder, err := zstdEncoder()
+		if err != nil {
+			return nil, err
+		}
+		return encoder.EncodeAll(payload, out), nil
+	default:
+		return nil, fmt.Errorf("unknown compression %q", compression)
+	}
+}
+
+func decompress(payload []byte) ([]byte, error) {
+	if len(payload) < 2 || payload[0] != compressionMarker {
+		return payload, nil
+	}
+	compression := Compression(payload[1])
+	magic, ok := compressionMagics[compression]
+	if !ok || !bytes.HasPrefix(payload[2:], magic) {
+		return payload, nil
+	}
+	switch compression {
+	case Gzip:
+		reader, err := gzip.NewReader(bytes.NewReader(payload[2:]))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	default:
+		decoder, err := zstdDecoder()
+		if err != nil {
+			return nil, err
+		}
+		return decoder.DecodeAll(payload[2:], nil)
+	}
+}
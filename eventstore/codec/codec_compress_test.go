@@ -0,0 +1,71 @@
+package codec_test
+
+import (
+	"github.com/nbarbey/go-event-store/eventstore/codec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+var soldAnOldMercedes = carSold{Brand: "Mercedes", Name: strings.Repeat("Class A, first hand, ", 100), Date: christmas}
+
+func TestCompressingCodec_Marshall_Unmarshall(t *testing.T) {
+	for _, compression := range []codec.Compression{codec.Gzip, codec.Zstd} {
+		t.Run(string(compression), func(t *testing.T) {
+			testCodecMarshalUnmarshal(t, codec.NewCompressingCodec[carSold](codec.NewJSONCodec[carSold](), compression).WithThreshold(0))
+
+			c := codec.NewCompressingCodec[carSold](codec.NewJSONCodec[carSold](), compression)
+			payload, err := c.Marshall(soldAnOldMercedes)
+			require.NoError(t, err)
+			received, err := c.Unmarshall(payload)
+			require.NoError(t, err)
+
+			assert.Less(t, len(payload), len(soldAnOldMercedes.Name))
+			assert.Equal(t, soldAnOldMercedes.Name, received.Name)
+		})
+	}
+}
+
+func TestCompressingCodec_Marshall_UnmarshallWithType(t *testing.T) {
+	testCodecMarshalUnmarshalWithType(t, codec.NewCompressingCodec[carEvent](codec.NewJSONCodecWithTypeHints[carEvent](codec.NewUnmarshallerMap[carEvent]().
+		AddFunc("carSold", func(payload []byte) (event carEvent, err error) {
+			return codec.BuildJSONUnmarshalFunc[carSold]()(payload)
+		}).
+		AddFunc("carRepaired", func(payload []byte) (event carEvent, err error) {
+			return codec.BuildJSONUnmarshalFunc[carRepaired]()(payload)
+		})), codec.Zstd).WithThreshold(0))
+}
+
+func TestCompressingCodec_small_payloads(t *testing.T) {
+	c := codec.NewCompressingCodec[carSold](codec.NewJSONCodec[carSold](), codec.Gzip)
+
+	payload, err := c.Marshall(soldAMercedesForChristmas)
+	require.NoError(t, err)
+	uncompressed, err := codec.NewJSONCodec[carSold]().Marshall(soldAMercedesForChristmas)
+	require.NoError(t, err)
+
+	assert.Equal(t, uncompressed, payload)
+}
+
+func TestCompressingCodec_reads_previous_payloads(t *testing.T) {
+	t.Run("uncompressed", func(t *testing.T) {
+		payload, err := codec.NewGobCodec[carSold]().Marshall(soldAnOldMercedes)
+		require.NoError(t, err)
+
+		received, err := codec.NewCompressingCodec[carSold](codec.NewGobCodec[carSold](), codec.Zstd).Unmarshall(payload)
+		require.NoError(t, err)
+
+		assert.Equal(t, soldAnOldMercedes.Name, received.Name)
+	})
+
+	t.Run("with another compression", func(t *testing.T) {
+		payload, err := codec.NewCompressingCodec[carSold](codec.NewJSONCodec[carSold](), codec.Gzip).Marshall(soldAnOldMercedes)
+		require.NoError(t, err)
+
+		received, err := codec.NewCompressingCodec[carSold](codec.NewJSONCodec[carSold](), codec.Zstd).Unmarshall(payload)
+		require.NoError(t, err)
+
+		assert.Equal(t, soldAnOldMercedes.Name, received.Name)
+	})
+}
@@ -0,0 +1,140 @@
+package codec
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var ErrSubjectForgotten = errors.New("subject forgotten")
+var ErrMalformedEncryptedPayload = errors.New("malformed encrypted payload")
+
+// Encrypted payloads start like compressed ones, then tell the subject they are encrypted
+// for, so that its key can be looked up, before the nonce and the AES-GCM ciphertext.
+var encryptionHeader = []byte{compressionMarker, 'a'}
+
+// EncryptingCodec encrypts the payloads of its inner codec with the key of the subject of
+// each event, a customer or the owner of a stream for instance. Once the key of a subject
+// is deleted, its events fail to decode with ErrSubjectForgotten and event stores skip
+// them, while the events of other subjects read as before.
+//
+// Subjects are told by the event alone with NewEncryptingCodec, and by the stream the event
+// is appended to as well with NewStreamEncryptingCodec: event stores pass the stream along
+// through MarshallToStream, while Marshall alone knows no stream.
+//
+// Events without subject, and payloads stored before encryption was enabled, are left in
+// the clear. Compression, if any, belongs to the inner codec.
+type EncryptingCodec[E any] struct {
+	inner   Codec[E]
+	keys    KeyProvider
+	subject func(stream string, event E) string
+}
+
+func NewEncryptingCodec[E any](inner Codec[E], keys KeyProvider, subject func(event E) string) *EncryptingCodec[E] {
+	return NewStreamEncryptingCodec(inner, keys, func(_ string, event E) string { return subject(event) })
+}
+
+// NewStreamEncryptingCodec encrypts events with the key of subject, given the stream they
+// are appended to, such as the stream itself to encrypt each stream with its own key.
+func NewStreamEncryptingCodec[E any](inner Codec[E], keys KeyProvider, subject func(stream string, event E) string) *EncryptingCodec[E] {
+	return &EncryptingCodec[E]{inner: inner, keys: keys, subject: subject}
+}
+
+func (c *EncryptingCodec[E]) Marshall(event E) ([]byte, error) {
+	return c.MarshallToStream("", event)
+}
+
+func (c *EncryptingCodec[E]) MarshallToStream(stream string, event E) ([]byte, error) {
+	payload, err := MarshallToStream(c.inner, stream, event)
+	subject := c.subject(stream, event)
+	if err != nil || subject == "" {
+		return payload, err
+	}
+	key, err := c.keys.CreateKey(subject)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	out := binary.AppendUvarint(bytes.Clone(encryptionHeader), uint64(len(subject)))
+	out = append(out, subject...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out = append(out, nonce...)
+	// the subject is authenticated so that a payload cannot be passed off as another's
+	return aead.Seal(out, nonce, payload, []byte(subject)), nil
+}
+
+func (c *EncryptingCodec[E]) Unmarshall(payload []byte) (event E, err error) {
+	payload, err = c.decrypt(payload)
+	if err != nil {
+		return event, err
+	}
+	return c.inner.Unmarshall(payload)
+}
+
+func (c *EncryptingCodec[E]) ContentType() string {
+	return ContentTypeOf(c.inner)
+}
+
+func (c *EncryptingCodec[E]) EventTypeHint(event E) string {
+	return EventTypeHintOf(c.inner, event)
+}
+
+func (c *EncryptingCodec[E]) UnmarshallWithType(typeHint string, payload []byte) (event E, err error) {
+	typed, ok := c.inner.(TypedUnmarshaller[E])
+	if !ok {
+		return c.Unmarshall(payload)
+	}
+	payload, err = c.decrypt(payload)
+	if err != nil {
+		return event, err
+	}
+	return typed.UnmarshallWithType(typeHint, payload)
+}
+
+func (c *EncryptingCodec[E]) decrypt(payload []byte) ([]byte, error) {
+	if !bytes.HasPrefix(payload, encryptionHeader) {
+		return payload, nil
+	}
+	rest := payload[len(encryptionHeader):]
+	length, n := binary.Uvarint(rest)
+	if n <= 0 || uint64(len(rest)-n) < length {
+		return nil, ErrMalformedEncryptedPayload
+	}
+	subject := string(rest[n : n+int(length)])
+	rest = rest[n+int(length):]
+
+	key, err := c.keys.Key(subject)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, fmt.Errorf("%w: %q", ErrSubjectForgotten, subject)
+	}
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < aead.NonceSize() {
+		return nil, ErrMalformedEncryptedPayload
+	}
+	return aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], []byte(subject))
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,161 @@
+package codec_test
+
+import (
+	"github.com/nbarbey/go-event-store/eventstore/codec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func carSubject(event carSold) string {
+	return event.Brand
+}
+
+func TestEncryptingCodec_Marshall_Unmarshall(t *testing.T) {
+	testCodecMarshalUnmarshal(t, codec.NewEncryptingCodec[carSold](codec.NewJSONCodec[carSold](), codec.NewInMemoryKeyProvider(), carSubject))
+
+	t.Run("payloads are encrypted", func(t *testing.T) {
+		c := codec.NewEncryptingCodec[carSold](codec.NewJSONCodec[carSold](), codec.NewInMemoryKeyProvider(), carSubject)
+
+		payload, err := c.Marshall(soldAMercedesForChristmas)
+		require.NoError(t, err)
+
+		assert.NotContains(t, string(payload), soldAMercedesForChristmas.Name)
+	})
+}
+
+func TestEncryptingCodec_Marshall_UnmarshallWithType(t *testing.T) {
+	testCodecMarshalUnmarshalWithType(t, codec.NewEncryptingCodec[carEvent](codec.NewJSONCodecWithTypeHints[carEvent](codec.NewUnmarshallerMap[carEvent]().
+		AddFunc("carSold", func(payload []byte) (event carEvent, err error) {
+			return codec.BuildJSONUnmarshalFunc[carSold]()(payload)
+		}).
+		AddFunc("carRepaired", func(payload []byte) (event carEvent, err error) {
+			return codec.BuildJSONUnmarshalFunc[carRepaired]()(payload)
+		})), codec.NewInMemoryKeyProvider(), func(event carEvent) string {
+		return "garage"
+	}))
+}
+
+func TestEncryptingCodec_crypto_shredding(t *testing.T) {
+	fileKeys, err := codec.NewFileKeyProvider(t.TempDir())
+	require.NoError(t, err)
+	providers := map[string]codec.KeyProvider{"in memory": codec.NewInMemoryKeyProvider(), "file": fileKeys}
+
+	for name, keys := range providers {
+		t.Run(name, func(t *testing.T) {
+			c := codec.NewEncryptingCodec[carSold](codec.NewJSONCodec[carSold](), keys, carSubject)
+			mercedes, err := c.Marshall(soldAMercedesForChristmas)
+			require.NoError(t, err)
+			renault, err := c.Marshall(carSold{Brand: "Renault"})
+			require.NoError(t, err)
+
+			require.NoError(t, keys.DeleteKey("Mercedes"))
+
+			_, err = c.Unmarshall(mercedes)
+			assert.ErrorIs(t, err, codec.ErrSubjectForgotten)
+			received, err := c.Unmarshall(renault)
+			require.NoError(t, err)
+			assert.Equal(t, "Renault", received.Brand)
+		})
+	}
+}
+
+func TestEncryptingCodec_reads_clear_payloads(t *testing.T) {
+	c := codec.NewEncryptingCodec[carSold](codec.NewJSONCodec[carSold](), codec.NewInMemoryKeyProvider(), func(carSold) string { return "" })
+
+	payload, err := c.Marshall(soldAMercedesForChristmas)
+	require.NoError(t, err)
+	clear, err := codec.NewJSONCodec[carSold]().Marshall(soldAMercedesForChristmas)
+	require.NoError(t, err)
+	assert.Equal(t, clear, payload)
+
+	received, err := c.Unmarshall(clear)
+	require.NoError(t, err)
+	assert.Equal(t, soldAMercedesForChristmas.Name, received.Name)
+}
+
+func TestEncryptingCodec_keyed_by_stream(t *testing.T) {
+	keys := codec.NewInMemoryKeyProvider()
+	c := codec.NewStreamEncryptingCodec[carSold](codec.NewJSONCodec[carSold](), keys,
+		func(stream string, _ carSold) string { return stream })
+	alice, err := codec.MarshallToStream[carSold](c, "customer-alice", soldAMercedesForChristmas)
+	require.NoError(t, err)
+	bob, err := codec.MarshallToStream[carSold](c, "customer-bob", soldAMercedesForChristmas)
+	require.NoError(t, err)
+
+	require.NoError(t, keys.DeleteKey("customer-alice"))
+
+	_, err = c.Unmarshall(alice)
+	assert.ErrorIs(t, err, codec.ErrSubjectForgotten)
+	received, err := c.Unmarshall(bob)
+	require.NoError(t, err)
+	assert.Equal(t, soldAMercedesForChristmas.Name, received.Name)
+}
+
+func TestEncryptingCodec_subjects_are_authenticated(t *testing.T) {
+	keys := codec.NewInMemoryKeyProvider()
+	c := codec.NewEncryptingCodec[carSold](codec.NewJSONCodec[carSold](), keys, carSubject)
+	payload, err := c.Marshall(soldAMercedesForChristmas)
+	require.NoError(t, err)
+	key, err := keys.Key("Mercedes")
+	require.NoError(t, err)
+	// the same key, under another subject of the same length
+	forged := &fixedKeyProvider{key: key}
+
+	_, err = codec.NewEncryptingCodec[carSold](codec.NewJSONCodec[carSold](), forged, carSubject).
+		Unmarshall([]byte(string(payload[:3]) + "Mercedez" + string(payload[3+len("Mercedes"):])))
+
+	assert.Error(t, err)
+}
+
+type fixedKeyProvider struct {
+	key []byte
+}
+
+func (p *fixedKeyProvider) Key(string) ([]byte, error)       { return p.key, nil }
+func (p *fixedKeyProvider) CreateKey(string) ([]byte, error) { return p.key, nil }
+func (p *fixedKeyProvider) DeleteKey(string) error           { return nil }
+
+func TestFileKeyProvider_CreateKey(t *testing.T) {
+	t.Run("providers sharing a directory agree on keys", func(t *testing.T) {
+		directory := t.TempDir()
+		keys := make([][]byte, 8)
+		var wg sync.WaitGroup
+		for i := range keys {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				provider, err := codec.NewFileKeyProvider(directory)
+				require.NoError(t, err)
+				keys[i], err = provider.CreateKey("Mercedes")
+				require.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+
+		for _, key := range keys[1:] {
+			assert.Equal(t, keys[0], key)
+		}
+		entries, err := os.ReadDir(directory)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+
+	t.Run("keys of the wrong length are rejected", func(t *testing.T) {
+		directory := t.TempDir()
+		provider, err := codec.NewFileKeyProvider(directory)
+		require.NoError(t, err)
+		_, err = provider.CreateKey("Mercedes")
+		require.NoError(t, err)
+		entries, err := os.ReadDir(directory)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(directory, entries[0].Name()), []byte("short"), 0o600))
+
+		_, err = provider.Key("Mercedes")
+
+		assert.ErrorIs(t, err, codec.ErrMalformedKey)
+	})
+}
@@ -3,36 +3,58 @@ package codec
 import (
 	"bytes"
 	"encoding/gob"
+	"io"
+	"slices"
+	"sync"
 )
 
 func NewGobCodec[E any]() *GobCodec[E] {
-	c := GobCodec[E]{}
-	c.encoder = gob.NewEncoder(&c.encoderBuffer)
-	c.decoder = gob.NewDecoder(&c.decoderBuffer)
-	return &c
+	return &GobCodec[E]{}
 }
 
+// GobCodec encodes every event with its own encoder so that each payload carries its type
+// information and can be decoded on its own, in any order.
+//
+// Earlier versions shared one encoder per codec, which only sent the definition of a type
+// with the first event of that type. The codec still reads those payloads: it remembers the
+// type definitions of the payloads it decodes, and decodes the payloads missing some with
+// the definitions remembered, so that events are read as long as the first event of their
+// type was read before by the same codec, as earlier versions required.
 type GobCodec[E any] struct {
-	encoderBuffer bytes.Buffer
-	encoder       *gob.Encoder
-	decoderBuffer bytes.Buffer
-	decoder       *gob.Decoder
+	legacy gobTypes
 }
 
 func (g *GobCodec[E]) Marshall(event E) ([]byte, error) {
-	err := g.encoder.Encode(event)
-	out := g.encoderBuffer.Bytes()
-	g.encoderBuffer.Reset()
-	return out, err
+	var buffer bytes.Buffer
+	err := gob.NewEncoder(&buffer).Encode(event)
+	return buffer.Bytes(), err
 }
 
 func (g *GobCodec[E]) Unmarshall(payload []byte) (event E, err error) {
-	g.decoderBuffer.Write(payload)
-	err = g.decoder.Decode(&event)
-	g.decoderBuffer.Reset()
+	err = g.decode(payload, &event)
 	return event, err
 }
 
+func (g *GobCodec[E]) decode(payload []byte, target any) error {
+	defined := g.legacy.remember(payload)
+	err := gob.NewDecoder(bytes.NewReader(payload)).Decode(target)
+	if err == nil {
+		return nil
+	}
+	definitions := g.legacy.definitions(defined)
+	if len(definitions) == 0 {
+		return err
+	}
+	if gob.NewDecoder(io.MultiReader(bytes.NewReader(definitions), bytes.NewReader(payload))).Decode(target) != nil {
+		return err
+	}
+	return nil
+}
+
+func (g *GobCodec[E]) ContentType() string {
+	return ContentTypeGob
+}
+
 type GobCodecWithTypeHints[E any] struct {
 	*GobCodec[E]
 	*UnmarshalerWithTypeHint[E]
@@ -40,15 +62,99 @@ type GobCodecWithTypeHints[E any] struct {
 
 func NewGobCodecWithTypeHints[E any](unmarshalers UnmarshallerMap[E]) *GobCodecWithTypeHints[E] {
 	codec := NewGobCodec[E]()
+	unmarshaler := NewUnmarshalerWithTypeHints[E](codec, unmarshalers)
+	unmarshaler.registered = codec.decode
 	return &GobCodecWithTypeHints[E]{
 		GobCodec:                codec,
-		UnmarshalerWithTypeHint: NewUnmarshalerWithTypeHints[E](codec, unmarshalers),
+		UnmarshalerWithTypeHint: unmarshaler,
 	}
 }
 
+func (c *GobCodecWithTypeHints[E]) WithUnknownTypePolicy(policy UnknownTypePolicy) *GobCodecWithTypeHints[E] {
+	c.SetUnknownTypePolicy(policy)
+	return c
+}
+
 func BuildGobUnmarshalFunc[E any]() UnmarshalerFunc[E] {
 	c := NewGobCodec[E]()
 	return func(payload []byte) (event E, err error) {
 		return c.Unmarshall(payload)
 	}
 }
+
+// gobTypes holds the type definition messages met in gob payloads, by type id.
+type gobTypes struct {
+	mutex    sync.Mutex
+	messages map[int64][]byte
+}
+
+// remember keeps the type definitions payload starts with, and returns their ids.
+func (t *gobTypes) remember(payload []byte) (ids []int64) {
+	for len(payload) > 0 {
+		length, n := gobUint(payload)
+		if n == 0 || length > uint64(len(payload)-n) {
+			return ids
+		}
+		message := payload[:n+int(length)]
+		id, m := gobInt(message[n:])
+		// values have positive ids, definitions the opposite of the id of their type
+		if m == 0 || id >= 0 {
+			return ids
+		}
+		t.mutex.Lock()
+		if t.messages == nil {
+			t.messages = make(map[int64][]byte)
+		}
+		t.messages[-id] = message
+		t.mutex.Unlock()
+		ids = append(ids, -id)
+		payload = payload[len(message):]
+	}
+	return ids
+}
+
+// definitions returns the type definitions remembered but those of except, by type id.
+func (t *gobTypes) definitions(except []int64) []byte {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	var ids []int64
+	for id := range t.messages {
+		if !slices.Contains(except, id) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	var definitions []byte
+	for _, id := range ids {
+		definitions = append(definitions, t.messages[id]...)
+	}
+	return definitions
+}
+
+// gobUint reads an unsigned integer as gob encodes it, and returns the bytes read, or 0
+// when b is too short.
+func gobUint(b []byte) (uint64, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+	if b[0] < 0x80 {
+		return uint64(b[0]), 1
+	}
+	n := -int(int8(b[0]))
+	if n > 8 || len(b) < n+1 {
+		return 0, 0
+	}
+	var x uint64
+	for _, c := range b[1 : n+1] {
+		x = x<<8 | uint64(c)
+	}
+	return x, n + 1
+}
+
+func gobInt(b []byte) (int64, int) {
+	x, n := gobUint(b)
+	if x&1 != 0 {
+		return ^int64(x >> 1), n
+	}
+	return int64(x >> 1), n
+}
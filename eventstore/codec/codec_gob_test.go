@@ -1,7 +1,11 @@
 package codec_test
 
 import (
+	"bytes"
+	"encoding/gob"
 	"github.com/nbarbey/go-event-store/eventstore/codec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"testing"
 	"time"
 )
@@ -20,6 +24,43 @@ func TestGobCodec_Marshall_UnmarshallWithType(t *testing.T) {
 		})))
 }
 
+func TestGobCodec_Unmarshall_in_any_order(t *testing.T) {
+	c := codec.NewGobCodec[carSold]()
+	first, err := c.Marshall(soldAMercedesForChristmas)
+	require.NoError(t, err)
+	second, err := c.Marshall(carSold{Brand: "Renault"})
+	require.NoError(t, err)
+
+	received, err := codec.NewGobCodec[carSold]().Unmarshall(second)
+	require.NoError(t, err)
+	assert.Equal(t, "Renault", received.Brand)
+	received, err = c.Unmarshall(first)
+	require.NoError(t, err)
+	assert.Equal(t, soldAMercedesForChristmas.Brand, received.Brand)
+}
+
+func TestGobCodec_Unmarshall_payloads_of_a_shared_encoder(t *testing.T) {
+	// earlier versions encoded the events of a codec with one encoder
+	var buffer bytes.Buffer
+	encoder := gob.NewEncoder(&buffer)
+	var payloads [][]byte
+	for _, event := range []carSold{soldAMercedesForChristmas, {Brand: "Renault"}, {Brand: "Peugeot"}} {
+		require.NoError(t, encoder.Encode(event))
+		payloads = append(payloads, bytes.Clone(buffer.Bytes()))
+		buffer.Reset()
+	}
+
+	c := codec.NewGobCodec[carSold]()
+	for _, i := range []int{0, 2, 1, 2} {
+		received, err := c.Unmarshall(payloads[i])
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Mercedes", "Renault", "Peugeot"}[i], received.Brand)
+	}
+
+	_, err := codec.NewGobCodec[carSold]().Unmarshall(payloads[1])
+	assert.Error(t, err, "the first event was never read")
+}
+
 func BenchmarkGobCodec_Marshall(b *testing.B) {
 	c := codec.NewGobCodec[carSold]()
 
@@ -47,9 +88,11 @@ var bigBlaBla = largeEvent{
 func BenchmarkGobCodec_Marshall_big(b *testing.B) {
 	c := codec.NewGobCodec[largeEvent]()
 
+	var payload []byte
 	for i := 0; i < b.N; i++ {
-		_, _ = c.Marshall(bigBlaBla)
+		payload, _ = c.Marshall(bigBlaBla)
 	}
+	b.ReportMetric(float64(len(payload)), "payload-bytes")
 }
 
 func BenchmarkGobCodec_MarshallUnmarshal_big(b *testing.B) {
@@ -19,13 +19,24 @@ func (JSONCodec[E]) Unmarshall(payload []byte) (event E, err error) {
 	return event, err
 }
 
+func (JSONCodec[E]) ContentType() string {
+	return ContentTypeJSON
+}
+
 type JSONCodecWithTypeHints[E any] struct {
 	JSONCodec[E]
 	*UnmarshalerWithTypeHint[E]
 }
 
 func NewJSONCodecWithTypeHints[E any](unmarshalers UnmarshallerMap[E]) *JSONCodecWithTypeHints[E] {
-	return &JSONCodecWithTypeHints[E]{UnmarshalerWithTypeHint: NewUnmarshalerWithTypeHints[E](JSONCodec[E]{}, unmarshalers)}
+	unmarshaler := NewUnmarshalerWithTypeHints[E](JSONCodec[E]{}, unmarshalers)
+	unmarshaler.registered = json.Unmarshal
+	return &JSONCodecWithTypeHints[E]{UnmarshalerWithTypeHint: unmarshaler}
+}
+
+func (c *JSONCodecWithTypeHints[E]) WithUnknownTypePolicy(policy UnknownTypePolicy) *JSONCodecWithTypeHints[E] {
+	c.SetUnknownTypePolicy(policy)
+	return c
 }
 
 func BuildJSONUnmarshalFunc[E any]() UnmarshalerFunc[E] {
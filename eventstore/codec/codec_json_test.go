@@ -30,9 +30,11 @@ func BenchmarkJSONCodec_Marshall(b *testing.B) {
 func BenchmarkJSONCodec_Marshall_big(b *testing.B) {
 	c := codec.NewJSONCodec[largeEvent]()
 
+	var payload []byte
 	for i := 0; i < b.N; i++ {
-		_, _ = c.Marshall(bigBlaBla)
+		payload, _ = c.Marshall(bigBlaBla)
 	}
+	b.ReportMetric(float64(len(payload)), "payload-bytes")
 }
 
 func BenchmarkJSONCodec_MarshallUnmarshal_big(b *testing.B) {
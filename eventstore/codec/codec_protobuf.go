@@ -0,0 +1,115 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"reflect"
+)
+
+var ErrNotAProtobufMessage = errors.New("not a protobuf message")
+
+func NewProtobufCodec[E proto.Message]() *ProtobufCodec[E] {
+	return &ProtobufCodec[E]{}
+}
+
+// ProtobufCodec encodes events in the protobuf wire format, so that they can be read by
+// services that are not written in Go. E is a pointer to a generated message type.
+type ProtobufCodec[E proto.Message] struct{}
+
+func (ProtobufCodec[E]) Marshall(event E) ([]byte, error) {
+	return proto.Marshal(event)
+}
+
+func (ProtobufCodec[E]) Unmarshall(payload []byte) (event E, err error) {
+	// generated messages describe themselves even through a nil pointer
+	event = (*new(E)).ProtoReflect().Type().New().Interface().(E)
+	err = proto.Unmarshal(payload, event)
+	return event, err
+}
+
+func (ProtobufCodec[E]) ContentType() string {
+	return ContentTypeProtobuf
+}
+
+// ProtobufTypeHint is the type hint to publish a message with: its full protobuf name.
+func ProtobufTypeHint(message proto.Message) string {
+	return string(message.ProtoReflect().Descriptor().FullName())
+}
+
+// ProtobufCodecWithTypeHints decodes sum types of protobuf messages. Type hints are full
+// message names, looked up in the global protobuf registry unless an unmarshaller is
+// added for them. Payloads without type hint cannot be decoded, so events published
+// without one are given the full name of their message.
+type ProtobufCodecWithTypeHints[E any] struct {
+	*UnmarshalerWithTypeHint[E]
+	types *protoregistry.Types
+}
+
+func NewProtobufCodecWithTypeHints[E any](unmarshalers UnmarshallerMap[E]) *ProtobufCodecWithTypeHints[E] {
+	return &ProtobufCodecWithTypeHints[E]{
+		UnmarshalerWithTypeHint: NewUnmarshalerWithTypeHints[E](UnmarshalerFunc[E](func([]byte) (event E, err error) {
+			return event, fmt.Errorf("protobuf: payload without type hint: %w", ErrUnknownEventType)
+		}), unmarshalers),
+		types: protoregistry.GlobalTypes,
+	}
+}
+
+// WithTypes looks message types up in types rather than in the global registry.
+func (c *ProtobufCodecWithTypeHints[E]) WithTypes(types *protoregistry.Types) *ProtobufCodecWithTypeHints[E] {
+	c.types = types
+	return c
+}
+
+func (c *ProtobufCodecWithTypeHints[E]) WithUnknownTypePolicy(policy UnknownTypePolicy) *ProtobufCodecWithTypeHints[E] {
+	c.SetUnknownTypePolicy(policy)
+	return c
+}
+
+func (c *ProtobufCodecWithTypeHints[E]) Marshall(event E) ([]byte, error) {
+	message, ok := any(event).(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%T: %w", event, ErrNotAProtobufMessage)
+	}
+	return proto.Marshal(message)
+}
+
+func (c *ProtobufCodecWithTypeHints[E]) EventTypeHint(event E) string {
+	message, ok := any(event).(proto.Message)
+	if !ok {
+		return ""
+	}
+	return ProtobufTypeHint(message)
+}
+
+func (c *ProtobufCodecWithTypeHints[E]) Unmarshall(payload []byte) (event E, err error) {
+	return c.UnmarshallWithType("", payload)
+}
+
+func (c *ProtobufCodecWithTypeHints[E]) ContentType() string {
+	return ContentTypeProtobuf
+}
+
+func (c *ProtobufCodecWithTypeHints[E]) UnmarshallWithType(typeHint string, payload []byte) (event E, err error) {
+	if _, ok := c.unmarshalers[typeHint]; ok || typeHint == "" {
+		return c.UnmarshalerWithTypeHint.UnmarshallWithType(typeHint, payload)
+	}
+	messageType, err := c.types.FindMessageByName(protoreflect.FullName(typeHint))
+	if errors.Is(err, protoregistry.NotFound) {
+		return c.UnmarshalerWithTypeHint.UnmarshallWithType(typeHint, payload)
+	}
+	if err != nil {
+		return event, err
+	}
+	message := messageType.New().Interface()
+	if err = proto.Unmarshal(payload, message); err != nil {
+		return event, err
+	}
+	event, ok := message.(E)
+	if !ok {
+		return event, fmt.Errorf("protobuf: %s does not implement %s", typeHint, reflect.TypeFor[E]())
+	}
+	return event, nil
+}
@@ -0,0 +1,97 @@
+package codec_test
+
+import (
+	"github.com/nbarbey/go-event-store/eventstore/codec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"testing"
+)
+
+func TestProtobufCodec_Marshall_Unmarshall(t *testing.T) {
+	c := codec.NewProtobufCodec[*timestamppb.Timestamp]()
+
+	payload, err := c.Marshall(timestamppb.New(christmas))
+	require.NoError(t, err)
+
+	received, err := c.Unmarshall(payload)
+	require.NoError(t, err)
+	assert.True(t, christmas.Equal(received.AsTime()))
+}
+
+func TestProtobufCodec_Marshall_UnmarshallWithType(t *testing.T) {
+	sold := timestamppb.New(christmas)
+	repaired := wrapperspb.String("1")
+
+	t.Run("message types from the protobuf registry", func(t *testing.T) {
+		c := codec.NewProtobufCodecWithTypeHints[proto.Message](nil)
+
+		payload, err := c.Marshall(sold)
+		require.NoError(t, err)
+		receivedSold, err := c.UnmarshallWithType(codec.ProtobufTypeHint(sold), payload)
+		require.NoError(t, err)
+		payload, err = c.Marshall(repaired)
+		require.NoError(t, err)
+		receivedRepaired, err := c.UnmarshallWithType(codec.ProtobufTypeHint(repaired), payload)
+		require.NoError(t, err)
+
+		assert.Equal(t, "google.protobuf.Timestamp", codec.ProtobufTypeHint(sold))
+		assert.True(t, christmas.Equal(receivedSold.(*timestamppb.Timestamp).AsTime()))
+		assert.Equal(t, "1", receivedRepaired.(*wrapperspb.StringValue).GetValue())
+	})
+
+	t.Run("unmarshallers come first", func(t *testing.T) {
+		c := codec.NewProtobufCodecWithTypeHints[proto.Message](codec.NewUnmarshallerMap[proto.Message]().
+			AddFunc("carRepaired", func(payload []byte) (proto.Message, error) {
+				return codec.NewProtobufCodec[*wrapperspb.StringValue]().Unmarshall(payload)
+			}))
+
+		payload, err := c.Marshall(repaired)
+		require.NoError(t, err)
+		received, err := c.UnmarshallWithType("carRepaired", payload)
+		require.NoError(t, err)
+
+		assert.Equal(t, "1", received.(*wrapperspb.StringValue).GetValue())
+	})
+
+	t.Run("unknown message types", func(t *testing.T) {
+		c := codec.NewProtobufCodecWithTypeHints[proto.Message](nil).
+			WithTypes(new(protoregistry.Types)).
+			WithUnknownTypePolicy(codec.RejectUnknownTypes)
+
+		payload, err := c.Marshall(repaired)
+		require.NoError(t, err)
+		_, err = c.UnmarshallWithType(codec.ProtobufTypeHint(repaired), payload)
+
+		assert.ErrorIs(t, err, codec.ErrUnknownEventType)
+	})
+
+	t.Run("payloads without type hint", func(t *testing.T) {
+		c := codec.NewProtobufCodecWithTypeHints[proto.Message](nil)
+
+		_, err := c.Unmarshall([]byte{})
+
+		assert.ErrorIs(t, err, codec.ErrUnknownEventType)
+	})
+
+	t.Run("events that are not messages", func(t *testing.T) {
+		c := codec.NewProtobufCodecWithTypeHints[carEvent](nil)
+
+		_, err := c.Marshall(repairedAMercedes)
+
+		assert.ErrorIs(t, err, codec.ErrNotAProtobufMessage)
+	})
+}
+
+func BenchmarkProtobufCodec_MarshallUnmarshal(b *testing.B) {
+	c := codec.NewProtobufCodec[*timestamppb.Timestamp]()
+	sold := timestamppb.New(christmas)
+
+	for i := 0; i < b.N; i++ {
+		payload, _ := c.Marshall(sold)
+		_, _ = c.Unmarshall(payload)
+	}
+}
@@ -12,6 +12,8 @@ type TypedCodec[E any] interface {
 type UnmarshalerWithTypeHint[E any] struct {
 	defaultUnmarshaler Unmarshaller[E]
 	unmarshalers       map[string]Unmarshaller[E]
+	registered         decodeFunc
+	policy             UnknownTypePolicy
 }
 
 func NewUnmarshalerWithTypeHints[E any](defaultUnmarshaler Unmarshaller[E], unmarshalers map[string]Unmarshaller[E]) *UnmarshalerWithTypeHint[E] {
@@ -29,5 +31,17 @@ func (j UnmarshalerWithTypeHint[E]) UnmarshallWithType(typeHint string, payload
 	if ok {
 		return u.Unmarshall(payload)
 	}
+	if j.registered != nil {
+		if event, ok, err := decodeRegistered[E](typeHint, payload, j.registered); ok {
+			return event, err
+		}
+	}
+	if typeHint != "" && j.policy != UseDefaultUnmarshaller {
+		return event, &UnknownEventTypeError{UnknownEvent: UnknownEvent{TypeHint: typeHint, Payload: payload}, Policy: j.policy}
+	}
 	return j.defaultUnmarshaler.Unmarshall(payload)
 }
+
+func (j *UnmarshalerWithTypeHint[E]) SetUnknownTypePolicy(policy UnknownTypePolicy) {
+	j.policy = policy
+}
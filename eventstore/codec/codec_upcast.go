@@ -0,0 +1,155 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const schemaVersionSeparator = "/v"
+
+// VersionedTypeHint tags a type hint with the schema version of the payload. Version 1 is
+// the bare type name, so that events stored before a type was versioned read as version 1.
+func VersionedTypeHint(name string, version int) string {
+	if version <= 1 {
+		return name
+	}
+	return name + schemaVersionSeparator + strconv.Itoa(version)
+}
+
+func ParseTypeHint(typeHint string) (name string, version int) {
+	i := strings.LastIndex(typeHint, schemaVersionSeparator)
+	if i < 0 {
+		return typeHint, 1
+	}
+	version, err := strconv.Atoi(typeHint[i+len(schemaVersionSeparator):])
+	if err != nil || version < 1 {
+		return typeHint, 1
+	}
+	return typeHint[:i], version
+}
+
+type PayloadUpcaster func(payload []byte) ([]byte, error)
+
+type ValueUpcaster[E any] func(event E) (E, error)
+
+var ErrPayloadUpcastAfterDecoding = errors.New("payload upcaster registered after a value upcaster")
+
+type upcastKey struct {
+	name    string
+	version int
+}
+
+type upcastStep[E any] struct {
+	payload PayloadUpcaster
+	value   ValueUpcaster[E]
+}
+
+// Upcaster brings payloads of older schema versions, or of renamed types, to the current
+// version before they are handed out. Each step upgrades a type from one version to the
+// next: payload steps run on the raw payload, value steps on the decoded event, so that
+// the payload steps of a type must come before its value steps. The codec it wraps only
+// ever sees current type names, without schema version.
+type Upcaster[E any] struct {
+	TypedCodec[E]
+	aliases map[string]string
+	steps   map[upcastKey]upcastStep[E]
+	current map[string]int
+}
+
+func NewUpcaster[E any](c TypedCodec[E]) *Upcaster[E] {
+	return &Upcaster[E]{
+		TypedCodec: c,
+		aliases:    make(map[string]string),
+		steps:      make(map[upcastKey]upcastStep[E]),
+		current:    make(map[string]int),
+	}
+}
+
+// Alias makes events stored under oldName decode as name.
+func (u *Upcaster[E]) Alias(oldName, name string) *Upcaster[E] {
+	u.aliases[oldName] = name
+	return u
+}
+
+func (u *Upcaster[E]) UpcastPayload(name string, fromVersion int, f PayloadUpcaster) *Upcaster[E] {
+	return u.addStep(name, fromVersion, upcastStep[E]{payload: f})
+}
+
+func (u *Upcaster[E]) UpcastValue(name string, fromVersion int, f ValueUpcaster[E]) *Upcaster[E] {
+	return u.addStep(name, fromVersion, upcastStep[E]{value: f})
+}
+
+func (u *Upcaster[E]) addStep(name string, fromVersion int, step upcastStep[E]) *Upcaster[E] {
+	u.steps[upcastKey{name: name, version: fromVersion}] = step
+	u.current[name] = max(u.current[name], fromVersion+1)
+	return u
+}
+
+// TypeHinter versions the names events are published under, as Upcaster does.
+type TypeHinter interface {
+	TypeHint(name string) string
+}
+
+// TypeHint is the type hint to publish new events of the named type with.
+func (u *Upcaster[E]) TypeHint(name string) string {
+	return VersionedTypeHint(name, u.current[name])
+}
+
+func (u *Upcaster[E]) MarshallToStream(stream string, event E) ([]byte, error) {
+	return MarshallToStream[E](u.TypedCodec, stream, event)
+}
+
+func (u *Upcaster[E]) EventTypeHint(event E) string {
+	return EventTypeHintOf(u.TypedCodec, event)
+}
+
+func (u *Upcaster[E]) ContentType() string {
+	return ContentTypeOf(u.TypedCodec)
+}
+
+func (u *Upcaster[E]) UnmarshallWithType(typeHint string, payload []byte) (event E, err error) {
+	name, version := ParseTypeHint(typeHint)
+	name = u.resolve(name)
+
+	decoded := false
+	for ; version < u.current[name]; version++ {
+		step, ok := u.steps[upcastKey{name: name, version: version}]
+		switch {
+		case !ok:
+			continue
+		case step.payload != nil && decoded:
+			return event, fmt.Errorf("upcasting %s from version %d: %w", name, version, ErrPayloadUpcastAfterDecoding)
+		case step.payload != nil:
+			payload, err = step.payload(payload)
+		default:
+			if !decoded {
+				event, err = u.TypedCodec.UnmarshallWithType(name, payload)
+				if err != nil {
+					return
+				}
+				decoded = true
+			}
+			event, err = step.value(event)
+		}
+		if err != nil {
+			return event, fmt.Errorf("upcasting %s from version %d: %w", name, version, err)
+		}
+	}
+	if decoded {
+		return event, nil
+	}
+	return u.TypedCodec.UnmarshallWithType(name, payload)
+}
+
+func (u *Upcaster[E]) resolve(name string) string {
+	for range len(u.aliases) {
+		alias, ok := u.aliases[name]
+		if !ok {
+			break
+		}
+		name = alias
+	}
+	return name
+}
@@ -0,0 +1,82 @@
+package codec_test
+
+import (
+	"bytes"
+	"github.com/nbarbey/go-event-store/eventstore/codec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func newCarUpcaster() *codec.Upcaster[carEvent] {
+	return codec.NewUpcaster[carEvent](codec.NewJSONCodecWithTypeHints[carEvent](codec.NewUnmarshallerMap[carEvent]().
+		AddFunc("carSold", func(payload []byte) (event carEvent, err error) {
+			return codec.BuildJSONUnmarshalFunc[carSold]()(payload)
+		}))).
+		// version 1 called the name of the car its model
+		UpcastPayload("carSold", 1, func(payload []byte) ([]byte, error) {
+			return bytes.Replace(payload, []byte(`"Model"`), []byte(`"Name"`), 1), nil
+		}).
+		// version 2 did not record the brand of second-hand cars
+		UpcastValue("carSold", 2, func(event carEvent) (carEvent, error) {
+			sold := event.(carSold)
+			if sold.Brand == "" {
+				sold.Brand = "unknown"
+			}
+			return sold, nil
+		}).
+		Alias("carBought", "carSold")
+}
+
+func TestUpcaster(t *testing.T) {
+	t.Run("type hints carry the schema version", func(t *testing.T) {
+		assert.Equal(t, "carSold", codec.VersionedTypeHint("carSold", 1))
+		assert.Equal(t, "carSold/v3", codec.VersionedTypeHint("carSold", 3))
+
+		name, version := codec.ParseTypeHint("carSold/v3")
+		assert.Equal(t, "carSold", name)
+		assert.Equal(t, 3, version)
+		name, version = codec.ParseTypeHint("carSold")
+		assert.Equal(t, "carSold", name)
+		assert.Equal(t, 1, version)
+	})
+
+	t.Run("current type hint", func(t *testing.T) {
+		assert.Equal(t, "carSold/v3", newCarUpcaster().TypeHint("carSold"))
+		assert.Equal(t, "carRepaired", newCarUpcaster().TypeHint("carRepaired"))
+	})
+
+	t.Run("upcast payloads then values of older versions", func(t *testing.T) {
+		event, err := newCarUpcaster().UnmarshallWithType("carSold", []byte(`{"Model":"Class A"}`))
+		require.NoError(t, err)
+		assert.Equal(t, carSold{Brand: "unknown", Name: "Class A"}, event)
+
+		event, err = newCarUpcaster().UnmarshallWithType("carSold/v2", []byte(`{"Name":"Class A"}`))
+		require.NoError(t, err)
+		assert.Equal(t, carSold{Brand: "unknown", Name: "Class A"}, event)
+	})
+
+	t.Run("current version is decoded as is", func(t *testing.T) {
+		c := newCarUpcaster()
+		payload, err := c.Marshall(soldAMercedesForChristmas)
+		require.NoError(t, err)
+
+		event, err := c.UnmarshallWithType(c.TypeHint("carSold"), payload)
+		require.NoError(t, err)
+		assert.Equal(t, soldAMercedesForChristmas.Name, event.(carSold).Name)
+		assert.Equal(t, soldAMercedesForChristmas.Brand, event.(carSold).Brand)
+	})
+
+	t.Run("renamed types keep decoding", func(t *testing.T) {
+		event, err := newCarUpcaster().UnmarshallWithType("carBought", []byte(`{"Brand":"Fiat","Model":"Panda"}`))
+		require.NoError(t, err)
+		assert.Equal(t, carSold{Brand: "Fiat", Name: "Panda"}, event)
+	})
+
+	t.Run("payload upcaster after a value upcaster", func(t *testing.T) {
+		c := newCarUpcaster().UpcastPayload("carSold", 3, func(payload []byte) ([]byte, error) { return payload, nil })
+
+		_, err := c.UnmarshallWithType("carSold", []byte(`{"Model":"Class A"}`))
+		assert.ErrorIs(t, err, codec.ErrPayloadUpcastAfterDecoding)
+	})
+}
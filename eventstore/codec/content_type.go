@@ -0,0 +1,22 @@
+package codec
+
+const (
+	ContentTypeGob      = "application/x-gob"
+	ContentTypeJSON     = "application/json"
+	ContentTypeCBOR     = "application/cbor"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// ContentTyper is implemented by codecs that tell the format of their payloads, which is
+// stored with every event so that events written with another codec can still be read.
+type ContentTyper interface {
+	ContentType() string
+}
+
+// ContentTypeOf returns the content type of a codec, or an empty string if it has none.
+func ContentTypeOf(c any) string {
+	if typer, ok := c.(ContentTyper); ok {
+		return typer.ContentType()
+	}
+	return ""
+}
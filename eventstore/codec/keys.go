@@ -0,0 +1,158 @@
+package codec
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var ErrKeyNotFound = errors.New("key not found")
+var ErrMalformedKey = errors.New("malformed key")
+
+const keySize = 32
+
+// KeyProvider holds one key per subject. Deleting the key of a subject makes the events
+// encrypted for it unreadable for good.
+type KeyProvider interface {
+	// Key returns ErrKeyNotFound when the subject has no key, or no longer has one.
+	Key(subject string) ([]byte, error)
+	// CreateKey returns the key of the subject, creating it when it has none.
+	CreateKey(subject string) ([]byte, error)
+	DeleteKey(subject string) error
+}
+
+func newKey() ([]byte, error) {
+	key := make([]byte, keySize)
+	_, err := rand.Read(key)
+	return key, err
+}
+
+type InMemoryKeyProvider struct {
+	mutex sync.Mutex
+	keys  map[string][]byte
+}
+
+func NewInMemoryKeyProvider() *InMemoryKeyProvider {
+	return &InMemoryKeyProvider{keys: make(map[string][]byte)}
+}
+
+func (p *InMemoryKeyProvider) Key(subject string) ([]byte, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	key, ok := p.keys[subject]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return key, nil
+}
+
+func (p *InMemoryKeyProvider) CreateKey(subject string) ([]byte, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if key, ok := p.keys[subject]; ok {
+		return key, nil
+	}
+	key, err := newKey()
+	if err != nil {
+		return nil, err
+	}
+	p.keys[subject] = key
+	return key, nil
+}
+
+func (p *InMemoryKeyProvider) DeleteKey(subject string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.keys, subject)
+	return nil
+}
+
+// FileKeyProvider keeps each key in a file of its own in a directory, readable by its
+// owner only. Keys are created without ever overwriting one, so that processes sharing the
+// directory agree on the key of each subject.
+type FileKeyProvider struct {
+	mutex     sync.Mutex
+	directory string
+}
+
+func NewFileKeyProvider(directory string) (*FileKeyProvider, error) {
+	if err := os.MkdirAll(directory, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileKeyProvider{directory: directory}, nil
+}
+
+func (p *FileKeyProvider) path(subject string) string {
+	return filepath.Join(p.directory, base64.RawURLEncoding.EncodeToString([]byte(subject))+".key")
+}
+
+func (p *FileKeyProvider) Key(subject string) ([]byte, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.read(subject)
+}
+
+func (p *FileKeyProvider) read(subject string) ([]byte, error) {
+	key, err := os.ReadFile(p.path(subject))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrKeyNotFound
+	}
+	if err == nil && len(key) != keySize {
+		return nil, fmt.Errorf("%w: %q is %d bytes long", ErrMalformedKey, subject, len(key))
+	}
+	return key, err
+}
+
+func (p *FileKeyProvider) CreateKey(subject string) ([]byte, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	key, err := p.read(subject)
+	if !errors.Is(err, ErrKeyNotFound) {
+		return key, err
+	}
+	key, err = newKey()
+	if err != nil {
+		return nil, err
+	}
+	err = p.create(subject, key)
+	if errors.Is(err, os.ErrExist) {
+		// another process created it first: its key is the one its events are encrypted with
+		return p.read(subject)
+	}
+	return key, err
+}
+
+// create writes the key to a temporary file then links it in place, which fails rather
+// than overwrite a key, and never exposes a partly written one.
+func (p *FileKeyProvider) create(subject string, key []byte) error {
+	file, err := os.CreateTemp(p.directory, ".key-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(key)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Link(file.Name(), p.path(subject))
+}
+
+func (p *FileKeyProvider) DeleteKey(subject string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	err := os.Remove(p.path(subject))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
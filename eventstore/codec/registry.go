@@ -0,0 +1,85 @@
+package codec
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+type decodeFunc func(payload []byte, target any) error
+
+type registry struct {
+	mutex sync.RWMutex
+	names map[reflect.Type]string
+	// decoders holds, for each event type, a func(decodeFunc, []byte) (E, error) per name
+	decoders map[reflect.Type]map[string]any
+}
+
+var types = &registry{names: make(map[reflect.Type]string), decoders: make(map[reflect.Type]map[string]any)}
+
+// Register records that events of type E may be a T, stored under the given type hint.
+// Publishing a T then sets the type hint on its own, and JSON and gob codecs of E decode
+// that type hint as a T. Like gob.Register, it panics when a name or a type is registered
+// twice differently.
+func Register[E any, T any](name string) {
+	if _, ok := any(*new(T)).(E); !ok {
+		panic(fmt.Sprintf("codec: %s does not implement %s", reflect.TypeFor[T](), reflect.TypeFor[E]()))
+	}
+	eventType, concreteType := reflect.TypeFor[E](), reflect.TypeFor[T]()
+
+	types.mutex.Lock()
+	defer types.mutex.Unlock()
+	if registered, ok := types.names[concreteType]; ok && registered != name {
+		panic(fmt.Sprintf("codec: %s registered as both %q and %q", concreteType, registered, name))
+	}
+	decoders, ok := types.decoders[eventType]
+	if !ok {
+		decoders = make(map[string]any)
+		types.decoders[eventType] = decoders
+	}
+	if _, ok := decoders[name]; ok && types.names[concreteType] != name {
+		panic(fmt.Sprintf("codec: %q registered twice for %s", name, eventType))
+	}
+	types.names[concreteType] = name
+	decoders[name] = func(decode decodeFunc, payload []byte) (event E, err error) {
+		var concrete T
+		err = decode(payload, &concrete)
+		return any(concrete).(E), err
+	}
+}
+
+// EventTypeHinter names the events it encodes, for those published without type hint and
+// whose type is not registered.
+type EventTypeHinter[E any] interface {
+	EventTypeHint(event E) string
+}
+
+// EventTypeHintOf returns the name c gives event, when c is an EventTypeHinter.
+func EventTypeHintOf[E any](c any, event E) string {
+	if hinter, ok := c.(EventTypeHinter[E]); ok {
+		return hinter.EventTypeHint(event)
+	}
+	return ""
+}
+
+// TypeHintOf returns the name the dynamic type of event is registered under, if any.
+func TypeHintOf(event any) string {
+	t := reflect.TypeOf(event)
+	if t == nil {
+		return ""
+	}
+	types.mutex.RLock()
+	defer types.mutex.RUnlock()
+	return types.names[t]
+}
+
+func decodeRegistered[E any](typeHint string, payload []byte, decode decodeFunc) (event E, ok bool, err error) {
+	types.mutex.RLock()
+	decoder, ok := types.decoders[reflect.TypeFor[E]()][typeHint]
+	types.mutex.RUnlock()
+	if !ok {
+		return
+	}
+	event, err = decoder.(func(decodeFunc, []byte) (E, error))(decode, payload)
+	return event, true, err
+}
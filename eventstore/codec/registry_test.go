@@ -0,0 +1,70 @@
+package codec_test
+
+import (
+	"github.com/nbarbey/go-event-store/eventstore/codec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type boatEvent interface {
+	isBoatEvent()
+}
+
+type boatSold struct{ Name string }
+
+func (boatSold) isBoatEvent() {}
+
+type boatSunk struct{ Depth int }
+
+func (*boatSunk) isBoatEvent() {}
+
+type boatRepaired struct{}
+
+func (boatRepaired) isBoatEvent() {}
+
+func init() {
+	codec.Register[boatEvent, boatSold]("boatSold")
+	codec.Register[boatEvent, *boatSunk]("boatSunk")
+}
+
+func testRegisteredTypes(t *testing.T, c codec.TypedCodec[boatEvent]) {
+	for _, event := range []boatEvent{boatSold{Name: "Titanic"}, &boatSunk{Depth: 3800}} {
+		payload, err := c.Marshall(event)
+		require.NoError(t, err)
+
+		received, err := c.UnmarshallWithType(codec.TypeHintOf(event), payload)
+		require.NoError(t, err)
+		assert.Equal(t, event, received)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	t.Run("type hint of registered types", func(t *testing.T) {
+		assert.Equal(t, "boatSold", codec.TypeHintOf(boatSold{}))
+		assert.Equal(t, "boatSunk", codec.TypeHintOf(&boatSunk{}))
+		assert.Empty(t, codec.TypeHintOf(boatSunk{}))
+		assert.Empty(t, codec.TypeHintOf(nil))
+	})
+
+	t.Run("JSON codec decodes registered types", func(t *testing.T) {
+		testRegisteredTypes(t, codec.NewJSONCodecWithTypeHints[boatEvent](nil))
+	})
+
+	t.Run("gob codec decodes registered types", func(t *testing.T) {
+		testRegisteredTypes(t, codec.NewGobCodecWithTypeHints[boatEvent](nil))
+	})
+
+	t.Run("registering the same type twice is allowed", func(t *testing.T) {
+		assert.NotPanics(t, func() { codec.Register[boatEvent, boatSold]("boatSold") })
+	})
+
+	t.Run("conflicting registrations panic", func(t *testing.T) {
+		assert.Panics(t, func() { codec.Register[boatEvent, boatSold]("boatBought") })
+		assert.Panics(t, func() { codec.Register[boatEvent, boatRepaired]("boatSold") })
+	})
+
+	t.Run("registering a type that is not an event panics", func(t *testing.T) {
+		assert.Panics(t, func() { codec.Register[boatEvent, carSold]("carSold") })
+	})
+}
@@ -0,0 +1,42 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrUnknownEventType = errors.New("unknown event type")
+
+// UnknownTypePolicy tells what to do with payloads whose type hint has no unmarshaller.
+// Events without type hint are always handed to the default unmarshaller.
+type UnknownTypePolicy int
+
+const (
+	UseDefaultUnmarshaller UnknownTypePolicy = iota
+	RejectUnknownTypes
+	SkipUnknownTypes
+	// KeepUnknownTypesRaw hands unknown events out as UnknownEvent to readers whose event
+	// type can hold one, and skips them for the others.
+	KeepUnknownTypesRaw
+)
+
+// UnknownEvent is an event whose type is unknown, kept as it was stored.
+type UnknownEvent struct {
+	TypeHint string
+	Payload  []byte
+}
+
+// UnknownEventTypeError is returned when decoding an unknown type hint, with the policy
+// readers should apply to the event.
+type UnknownEventTypeError struct {
+	UnknownEvent
+	Policy UnknownTypePolicy
+}
+
+func (e *UnknownEventTypeError) Error() string {
+	return fmt.Sprintf("%s: %q", ErrUnknownEventType, e.TypeHint)
+}
+
+func (e *UnknownEventTypeError) Unwrap() error {
+	return ErrUnknownEventType
+}
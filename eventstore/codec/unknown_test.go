@@ -0,0 +1,51 @@
+package codec_test
+
+import (
+	"errors"
+	"github.com/nbarbey/go-event-store/eventstore/codec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func newCarSoldOnlyCodec() *codec.JSONCodecWithTypeHints[carEvent] {
+	return codec.NewJSONCodecWithTypeHints[carEvent](codec.NewUnmarshallerMap[carEvent]().
+		AddFunc("carSold", func(payload []byte) (event carEvent, err error) {
+			return codec.BuildJSONUnmarshalFunc[carSold]()(payload)
+		}))
+}
+
+func TestUnknownTypePolicy(t *testing.T) {
+	payload := []byte(`{"CarID":"1"}`)
+
+	t.Run("default unmarshaller by default", func(t *testing.T) {
+		_, err := newCarSoldOnlyCodec().UnmarshallWithType("carRepaired", payload)
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, codec.ErrUnknownEventType)
+	})
+
+	for _, policy := range []codec.UnknownTypePolicy{codec.RejectUnknownTypes, codec.SkipUnknownTypes, codec.KeepUnknownTypesRaw} {
+		t.Run("unknown type error carries the policy", func(t *testing.T) {
+			_, err := newCarSoldOnlyCodec().WithUnknownTypePolicy(policy).UnmarshallWithType("carRepaired", payload)
+			require.ErrorIs(t, err, codec.ErrUnknownEventType)
+
+			var unknown *codec.UnknownEventTypeError
+			require.True(t, errors.As(err, &unknown))
+			assert.Equal(t, policy, unknown.Policy)
+			assert.Equal(t, codec.UnknownEvent{TypeHint: "carRepaired", Payload: payload}, unknown.UnknownEvent)
+		})
+	}
+
+	t.Run("known types and events without type hint are decoded", func(t *testing.T) {
+		c := codec.NewJSONCodecWithTypeHints[carSold](nil).WithUnknownTypePolicy(codec.RejectUnknownTypes)
+		payload, err := c.Marshall(soldAMercedesForChristmas)
+		require.NoError(t, err)
+
+		received, err := c.UnmarshallWithType("", payload)
+		require.NoError(t, err)
+		assert.Equal(t, soldAMercedesForChristmas.Name, received.Name)
+
+		_, err = newCarSoldOnlyCodec().WithUnknownTypePolicy(codec.RejectUnknownTypes).UnmarshallWithType("carSold", payload)
+		assert.NoError(t, err)
+	})
+}
@@ -9,3 +9,13 @@ type Consumer[E any] interface {
 func (f ConsumerFunc[E]) Consume(e E) {
 	f(e)
 }
+
+type BatchConsumerFunc[E any] func(events []E)
+
+type BatchConsumer[E any] interface {
+	ConsumeBatch(events []E)
+}
+
+func (f BatchConsumerFunc[E]) ConsumeBatch(events []E) {
+	f(events)
+}
@@ -0,0 +1,60 @@
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"github.com/nbarbey/go-event-store/eventstore/repository"
+)
+
+const defaultDeciderRetries = 3
+
+type Decider[S any, C any, E any] struct {
+	decide     func(S, C) ([]E, error)
+	evolve     func(S, E) S
+	typeHint   func(E) string
+	maxRetries int
+	es         *EventStore[E]
+}
+
+func NewDecider[S any, C any, E any](es *EventStore[E], decide func(S, C) ([]E, error), evolve func(S, E) S) *Decider[S, C, E] {
+	return &Decider[S, C, E]{
+		decide:     decide,
+		evolve:     evolve,
+		typeHint:   func(E) string { return "" },
+		maxRetries: defaultDeciderRetries,
+		es:         es,
+	}
+}
+
+func (d *Decider[S, C, E]) WithTypeHints(typeHint func(E) string) *Decider[S, C, E] {
+	return &Decider[S, C, E]{decide: d.decide, evolve: d.evolve, typeHint: typeHint, maxRetries: d.maxRetries, es: d.es}
+}
+
+func (d *Decider[S, C, E]) WithMaxRetries(maxRetries int) *Decider[S, C, E] {
+	return &Decider[S, C, E]{decide: d.decide, evolve: d.evolve, typeHint: d.typeHint, maxRetries: maxRetries, es: d.es}
+}
+
+// Handle loads the stream, decides which events the command results in and appends them
+// at once, expecting the stream not to have changed since it was loaded, or not to exist
+// yet when it was empty. When it has, nothing is appended and the whole cycle is retried
+// up to the configured number of times.
+func (d *Decider[S, C, E]) Handle(ctx context.Context, streamName string, command C) ([]E, error) {
+	stream := d.es.Listener.TypedRepository.Stream(streamName)
+	for attempt := 0; ; attempt++ {
+		aggregate := &Aggregate[S, E]{ID: streamName, apply: d.evolve}
+		err := aggregate.fold(ctx, stream)
+		if err != nil {
+			return nil, err
+		}
+		events, err := d.decide(aggregate.State, command)
+		if err != nil || len(events) == 0 {
+			return events, err
+		}
+		aggregate.pending = events
+		err = aggregate.commit(ctx, stream, d.typeHint)
+		if errors.Is(err, repository.ErrVersionMismatch) && attempt < d.maxRetries {
+			continue
+		}
+		return events, err
+	}
+}
@@ -0,0 +1,213 @@
+package eventstore_test
+
+import (
+	"context"
+	"errors"
+	"github.com/nbarbey/go-event-store/eventstore"
+	"github.com/nbarbey/go-event-store/eventstore/codec"
+	"github.com/nbarbey/go-event-store/eventstore/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type cartEvent interface {
+	isCartEvent()
+}
+
+type itemAdded struct{ Price int }
+
+func (itemAdded) isCartEvent() {}
+
+type itemRemoved struct{ Price int }
+
+func (itemRemoved) isCartEvent() {}
+
+type cart struct {
+	Items int
+	Total int
+}
+
+func applyCartEvent(c cart, e cartEvent) cart {
+	switch e := e.(type) {
+	case itemAdded:
+		c.Items++
+		c.Total += e.Price
+	case itemRemoved:
+		c.Items--
+		c.Total -= e.Price
+	}
+	return c
+}
+
+func cartTypeHint(e cartEvent) string {
+	switch e.(type) {
+	case itemAdded:
+		return "itemAdded"
+	case itemRemoved:
+		return "itemRemoved"
+	}
+	return ""
+}
+
+func newCartCodec() codec.TypedCodec[cartEvent] {
+	return codec.NewJSONCodecWithTypeHints[cartEvent](codec.NewUnmarshallerMap[cartEvent]().
+		AddFunc("itemAdded", func(payload []byte) (event cartEvent, err error) {
+			return codec.BuildJSONUnmarshalFunc[itemAdded]()(payload)
+		}).
+		AddFunc("itemRemoved", func(payload []byte) (event cartEvent, err error) {
+			return codec.BuildJSONUnmarshalFunc[itemRemoved]()(payload)
+		}))
+}
+
+func newCartEventStore() *eventstore.EventStore[cartEvent] {
+	return eventstore.NewEventStoreFromRepository(repository.NewTypedRepository[cartEvent](repository.NewInMemory(), newCartCodec()))
+}
+
+func TestAggregateRepository(t *testing.T) {
+	t.Run("load an aggregate that does not exist yet", func(t *testing.T) {
+		carts := eventstore.NewAggregateRepository[cart, cartEvent](newCartEventStore(), "cart", applyCartEvent)
+
+		c, err := carts.Load(context.Background(), "empty")
+		require.NoError(t, err)
+
+		assert.Equal(t, cart{}, c.State)
+		assert.Empty(t, c.Revision)
+	})
+
+	t.Run("save then load", func(t *testing.T) {
+		carts := eventstore.NewAggregateRepository[cart, cartEvent](newCartEventStore(), "cart", applyCartEvent).
+			WithTypeHints(cartTypeHint)
+		c := carts.New("1")
+		c.Raise(itemAdded{Price: 10}, itemAdded{Price: 5}, itemRemoved{Price: 10})
+		assert.Equal(t, cart{Items: 1, Total: 5}, c.State)
+
+		require.NoError(t, carts.Save(context.Background(), c))
+		assert.Empty(t, c.Pending())
+
+		loaded, err := carts.Load(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, cart{Items: 1, Total: 5}, loaded.State)
+		assert.Equal(t, c.Revision, loaded.Revision)
+	})
+
+	t.Run("reject concurrent save", func(t *testing.T) {
+		carts := eventstore.NewAggregateRepository[cart, cartEvent](newCartEventStore(), "cart", applyCartEvent).
+			WithTypeHints(cartTypeHint)
+		c := carts.New("2")
+		c.Raise(itemAdded{Price: 10})
+		require.NoError(t, carts.Save(context.Background(), c))
+
+		first, err := carts.Load(context.Background(), "2")
+		require.NoError(t, err)
+		second, err := carts.Load(context.Background(), "2")
+		require.NoError(t, err)
+
+		first.Raise(itemAdded{Price: 1})
+		require.NoError(t, carts.Save(context.Background(), first))
+		second.Raise(itemRemoved{Price: 10})
+		assert.ErrorIs(t, carts.Save(context.Background(), second), repository.ErrVersionMismatch)
+	})
+
+	t.Run("reject concurrent creation", func(t *testing.T) {
+		carts := eventstore.NewAggregateRepository[cart, cartEvent](newCartEventStore(), "cart", applyCartEvent).
+			WithTypeHints(cartTypeHint)
+		first := carts.New("3")
+		first.Raise(itemAdded{Price: 10})
+		second := carts.New("3")
+		second.Raise(itemAdded{Price: 20}, itemAdded{Price: 30})
+
+		require.NoError(t, carts.Save(context.Background(), first))
+		assert.ErrorIs(t, carts.Save(context.Background(), second), repository.ErrVersionMismatch)
+
+		loaded, err := carts.Load(context.Background(), "3")
+		require.NoError(t, err)
+		assert.Equal(t, cart{Items: 1, Total: 10}, loaded.State)
+	})
+}
+
+func TestAggregateRepository_with_snapshots(t *testing.T) {
+	r := repository.NewInMemory()
+	es := eventstore.NewEventStoreFromRepository(repository.NewTypedRepository[cartEvent](r, newCartCodec()))
+	carts := eventstore.NewAggregateRepository[cart, cartEvent](es, "cart", applyCartEvent).
+		WithTypeHints(cartTypeHint).
+		WithSnapshots(r, codec.NewJSONCodec[cart](), eventstore.EveryNEvents(3))
+
+	t.Run("take a snapshot every 3 events", func(t *testing.T) {
+		c := carts.New("snapshotted")
+		c.Raise(itemAdded{Price: 1}, itemAdded{Price: 2})
+		require.NoError(t, carts.Save(context.Background(), c))
+		_, err := r.LatestSnapshot(context.Background(), "cart-snapshotted")
+		require.ErrorIs(t, err, repository.ErrSnapshotNotFound)
+
+		c.Raise(itemAdded{Price: 3})
+		require.NoError(t, carts.Save(context.Background(), c))
+
+		snapshot, err := r.LatestSnapshot(context.Background(), "cart-snapshotted")
+		require.NoError(t, err)
+		assert.Equal(t, c.Revision, snapshot.Revision)
+		assert.Equal(t, c.Position, snapshot.Position)
+		assert.JSONEq(t, `{"Items": 3, "Total": 6}`, string(snapshot.Payload))
+	})
+
+	t.Run("load from latest snapshot and subsequent events", func(t *testing.T) {
+		c := carts.New("restored")
+		c.Raise(itemAdded{Price: 1})
+		require.NoError(t, carts.Save(context.Background(), c))
+		require.NoError(t, r.SaveSnapshot(context.Background(), repository.RawSnapshot{
+			StreamID: "cart-restored",
+			Revision: c.Revision,
+			Position: c.Position,
+			Payload:  []byte(`{"Items": 100, "Total": 1000}`),
+		}))
+		c.Raise(itemAdded{Price: 5})
+		require.NoError(t, carts.Save(context.Background(), c))
+
+		loaded, err := carts.Load(context.Background(), "restored")
+		require.NoError(t, err)
+
+		assert.Equal(t, cart{Items: 101, Total: 1005}, loaded.State)
+		assert.Equal(t, c.Revision, loaded.Revision)
+	})
+
+	t.Run("ignore snapshots of another schema version", func(t *testing.T) {
+		c := carts.New("reshaped")
+		c.Raise(itemAdded{Price: 1}, itemAdded{Price: 2}, itemAdded{Price: 3})
+		require.NoError(t, carts.Save(context.Background(), c))
+		require.NoError(t, r.SaveSnapshot(context.Background(), repository.RawSnapshot{
+			StreamID: "cart-reshaped",
+			Revision: c.Revision,
+			Position: c.Position,
+			Payload:  []byte(`{"Items": 100, "Total": 1000}`),
+		}))
+
+		loaded, err := carts.WithSnapshotVersion(2).Load(context.Background(), "reshaped")
+		require.NoError(t, err)
+
+		assert.Equal(t, cart{Items: 3, Total: 6}, loaded.State)
+	})
+
+	t.Run("save events when the snapshot fails", func(t *testing.T) {
+		failing := eventstore.NewAggregateRepository[cart, cartEvent](es, "cart", applyCartEvent).
+			WithTypeHints(cartTypeHint).
+			WithSnapshots(failingSnapshotStore{}, codec.NewJSONCodec[cart](), eventstore.EveryNEvents(1))
+		c := failing.New("unsnapshotted")
+		c.Raise(itemAdded{Price: 1})
+
+		require.NoError(t, failing.Save(context.Background(), c))
+
+		loaded, err := carts.Load(context.Background(), "unsnapshotted")
+		require.NoError(t, err)
+		assert.Equal(t, cart{Items: 1, Total: 1}, loaded.State)
+	})
+}
+
+type failingSnapshotStore struct{}
+
+func (failingSnapshotStore) SaveSnapshot(context.Context, repository.RawSnapshot) error {
+	return errors.New("snapshot store unavailable")
+}
+
+func (failingSnapshotStore) LatestSnapshot(context.Context, string) (*repository.RawSnapshot, error) {
+	return nil, repository.ErrSnapshotNotFound
+}
@@ -0,0 +1,95 @@
+package eventstore_test
+
+import (
+	"context"
+	"github.com/nbarbey/go-event-store/eventstore"
+	"github.com/nbarbey/go-event-store/eventstore/codec"
+	"github.com/nbarbey/go-event-store/eventstore/consumer"
+	"github.com/nbarbey/go-event-store/eventstore/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingCodec struct {
+	*codec.JSONCodecWithTypeHints[int]
+	decoded atomic.Int32
+}
+
+func (c *countingCodec) UnmarshallWithType(typeHint string, payload []byte) (event int, err error) {
+	c.decoded.Add(1)
+	return c.JSONCodecWithTypeHints.UnmarshallWithType(typeHint, payload)
+}
+
+func TestEventStore_batch_subscription(t *testing.T) {
+	t.Run("consume events by batches of max size", func(t *testing.T) {
+		es := eventstore.NewInMemoryEventStore[int]()
+		var mutex sync.Mutex
+		var batches [][]int
+		subscription, err := es.SubscribeBatch(consumer.BatchConsumerFunc[int](func(events []int) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			batches = append(batches, events)
+		}), eventstore.BatchOptions{MaxSize: 2, MaxWait: time.Second})
+		require.NoError(t, err)
+		defer subscription.Cancel()
+
+		for i := 0; i < 4; i++ {
+			require.NoError(t, es.Publish(context.Background(), i))
+		}
+
+		assert.Eventually(t, func() bool {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return len(batches) == 2
+		}, time.Second, time.Millisecond)
+		assert.Equal(t, [][]int{{0, 1}, {2, 3}}, batches)
+	})
+
+	t.Run("consume incomplete batch after max wait", func(t *testing.T) {
+		es := eventstore.NewInMemoryEventStore[int]()
+		received := make(chan []int, 1)
+		subscription, err := es.SubscribeBatch(consumer.BatchConsumerFunc[int](func(events []int) {
+			received <- events
+		}), eventstore.BatchOptions{MaxSize: 10, MaxWait: 20 * time.Millisecond})
+		require.NoError(t, err)
+		defer subscription.Cancel()
+
+		require.NoError(t, es.Publish(context.Background(), 42))
+
+		select {
+		case events := <-received:
+			assert.Equal(t, []int{42}, events)
+		case <-time.After(time.Second):
+			t.Fatal("batch was not consumed after max wait")
+		}
+	})
+
+	t.Run("stop fetching events when buffer is full", func(t *testing.T) {
+		c := &countingCodec{JSONCodecWithTypeHints: codec.NewJSONCodecWithTypeHints[int](nil)}
+		es := eventstore.NewEventStoreFromRepository(repository.NewTypedRepository[int](repository.NewInMemory(), c))
+		release := make(chan struct{})
+		var consumed atomic.Int32
+		subscription, err := es.SubscribeBatch(consumer.BatchConsumerFunc[int](func(events []int) {
+			<-release
+			consumed.Add(int32(len(events)))
+		}), eventstore.BatchOptions{MaxSize: 2, MaxWait: time.Hour, BufferSize: 3})
+		require.NoError(t, err)
+		defer subscription.Cancel()
+
+		// publishing does not wait for the blocked consumer
+		for i := 0; i < 20; i++ {
+			require.NoError(t, es.Publish(context.Background(), i))
+		}
+
+		// the consumer holds events 1 and 2, the buffer 3 to 5, and fetching waits to hand 6 over
+		assert.Eventually(t, func() bool { return subscription.Position() == 6 }, time.Second, time.Millisecond)
+		assert.Equal(t, int32(6), c.decoded.Load())
+		close(release)
+		assert.Eventually(t, func() bool { return consumed.Load() == 20 }, time.Second, time.Millisecond)
+		assert.Equal(t, int32(20), c.decoded.Load())
+	})
+}
@@ -0,0 +1,116 @@
+package eventstore_test
+
+import (
+	"context"
+	"github.com/nbarbey/go-event-store/eventstore"
+	"github.com/nbarbey/go-event-store/eventstore/codec"
+	"github.com/nbarbey/go-event-store/eventstore/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"testing"
+)
+
+func TestEventStore_mixed_content_types(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("move from gob to JSON", func(t *testing.T) {
+		r := repository.NewInMemory()
+		es := eventstore.NewEventStoreFromRepository(repository.NewTypedRepository[string](r, codec.NewGobCodecWithTypeHints[string](nil)))
+		require.NoError(t, es.Publish(ctx, "written with gob"))
+
+		es.WithCodec(codec.NewJSONCodecWithTypeHints[string](nil))
+		require.NoError(t, es.Publish(ctx, "written with JSON"))
+
+		events, err := es.Listener.All(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"written with gob", "written with JSON"}, events)
+		raws, err := r.AllRawEvents(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, codec.ContentTypeGob, raws[0].ContentType)
+		assert.Equal(t, codec.ContentTypeJSON, raws[1].ContentType)
+	})
+
+	t.Run("protobuf events published without type hint", func(t *testing.T) {
+		r := repository.NewInMemory()
+		es := eventstore.NewEventStoreFromRepository(repository.NewTypedRepository[proto.Message](r, codec.NewProtobufCodecWithTypeHints[proto.Message](nil)))
+		require.NoError(t, es.Publish(ctx, wrapperspb.String("no type hint given")))
+
+		events, err := es.Listener.All(ctx)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, "no type hint given", events[0].(*wrapperspb.StringValue).GetValue())
+		raws, err := r.AllRawEvents(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "google.protobuf.StringValue", raws[0].EventType)
+	})
+
+	t.Run("events stored without content type", func(t *testing.T) {
+		r := repository.NewInMemory()
+		payload, err := codec.NewGobCodec[string]().Marshall("stored before content types")
+		require.NoError(t, err)
+		_, err = r.InsertRawEvent(ctx, repository.RawEvent{Payload: payload}, "")
+		require.NoError(t, err)
+
+		es := eventstore.NewEventStoreFromRepository(repository.NewTypedRepository[string](r, codec.NewGobCodecWithTypeHints[string](nil)))
+		es.WithCodec(codec.NewJSONCodecWithTypeHints[string](nil))
+
+		events, err := es.Listener.All(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"stored before content types"}, events)
+	})
+
+	t.Run("assume a content type", func(t *testing.T) {
+		r := repository.NewInMemory()
+		payload, err := codec.NewJSONCodec[string]().Marshall("stored before content types")
+		require.NoError(t, err)
+		_, err = r.InsertRawEvent(ctx, repository.RawEvent{Payload: payload}, "")
+		require.NoError(t, err)
+
+		es := eventstore.NewEventStoreFromRepository(repository.NewTypedRepository[string](r, codec.NewCBORCodecWithTypeHints[string](nil)).
+			AddCodec(codec.NewJSONCodecWithTypeHints[string](nil)).
+			AssumeContentType(codec.ContentTypeJSON))
+
+		events, err := es.Listener.All(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"stored before content types"}, events)
+	})
+
+	t.Run("codecs added to a stream are its own", func(t *testing.T) {
+		r := repository.NewTypedRepository[string](repository.NewInMemory(), codec.NewGobCodecWithTypeHints[string](nil)).
+			AddCodec(codec.NewJSONCodecWithTypeHints[string](nil))
+		other := r.Stream("other")
+		stream := r.Stream("stream")
+		payload, err := codec.NewJSONCodec[string]().Marshall("written with JSON")
+		require.NoError(t, err)
+		_, err = other.InsertRawEvent(ctx, repository.RawEvent{ContentType: codec.ContentTypeJSON, Payload: payload}, "")
+		require.NoError(t, err)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			stream.WithCodec(codec.NewCBORCodecWithTypeHints[string](nil))
+		}()
+		events, err := other.All(ctx)
+		<-done
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"written with JSON"}, events)
+		err = other.InsertEvent(ctx, "", "", "still written with gob", "")
+		require.NoError(t, err)
+		raws, err := other.AllRawEvents(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, codec.ContentTypeGob, raws[1].ContentType)
+	})
+
+	t.Run("unknown content type", func(t *testing.T) {
+		r := repository.NewInMemory()
+		_, err := r.InsertRawEvent(ctx, repository.RawEvent{ContentType: "application/xml", Payload: []byte("<event/>")}, "")
+		require.NoError(t, err)
+
+		_, err = eventstore.NewEventStoreFromRepository(repository.NewTypedRepository[string](r, codec.NewJSONCodecWithTypeHints[string](nil))).Listener.All(ctx)
+
+		assert.ErrorIs(t, err, repository.ErrUnknownContentType)
+	})
+}
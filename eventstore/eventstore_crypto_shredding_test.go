@@ -0,0 +1,64 @@
+package eventstore_test
+
+import (
+	"context"
+	"github.com/nbarbey/go-event-store/eventstore"
+	"github.com/nbarbey/go-event-store/eventstore/codec"
+	"github.com/nbarbey/go-event-store/eventstore/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type subscribedToNewsletter struct {
+	CustomerID string
+	Email      string
+}
+
+func TestEventStore_crypto_shredding(t *testing.T) {
+	r := repository.NewInMemory()
+	keys := codec.NewInMemoryKeyProvider()
+	es := eventstore.NewEventStoreFromRepository(repository.NewTypedRepository[subscribedToNewsletter](r,
+		codec.NewEncryptingCodec[subscribedToNewsletter](codec.NewJSONCodec[subscribedToNewsletter](), keys,
+			func(event subscribedToNewsletter) string { return event.CustomerID })))
+	alice := subscribedToNewsletter{CustomerID: "alice", Email: "alice@example.com"}
+	bob := subscribedToNewsletter{CustomerID: "bob", Email: "bob@example.com"}
+	ctx := context.Background()
+	require.NoError(t, es.GetStream("newsletter").Publish(ctx, alice))
+	require.NoError(t, es.GetStream("newsletter").Publish(ctx, bob))
+
+	raws, err := r.AllRawEvents(ctx)
+	require.NoError(t, err)
+	for _, raw := range raws {
+		assert.NotContains(t, string(raw.Payload), "@example.com")
+	}
+
+	require.NoError(t, keys.DeleteKey("alice"))
+
+	events, err := es.GetStream("newsletter").Listener.All(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []subscribedToNewsletter{bob}, events)
+	envelopes, err := es.GetStream("newsletter").Listener.ReadEnvelopes(ctx, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, envelopes, 1)
+	assert.Equal(t, bob, envelopes[0].Event)
+}
+
+func TestEventStore_crypto_shredding_by_stream(t *testing.T) {
+	r := repository.NewInMemory()
+	keys := codec.NewInMemoryKeyProvider()
+	es := eventstore.NewEventStoreFromRepository(repository.NewTypedRepository[subscribedToNewsletter](r,
+		codec.NewStreamEncryptingCodec[subscribedToNewsletter](codec.NewJSONCodec[subscribedToNewsletter](), keys,
+			func(stream string, _ subscribedToNewsletter) string { return stream })))
+	alice := subscribedToNewsletter{CustomerID: "alice", Email: "alice@example.com"}
+	bob := subscribedToNewsletter{CustomerID: "bob", Email: "bob@example.com"}
+	ctx := context.Background()
+	require.NoError(t, es.GetStream("customer-alice").Publish(ctx, alice))
+	require.NoError(t, es.GetStream("customer-bob").Publish(ctx, bob))
+
+	require.NoError(t, keys.DeleteKey("customer-alice"))
+
+	events, err := es.GetStream(repository.CategoryStream("customer")).Listener.All(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []subscribedToNewsletter{bob}, events)
+}
@@ -27,9 +27,6 @@ func TestEventStore_with_custom_events(t *testing.T) {
 		myStream := customEventStore.GetStream("my-custom-event-stream")
 		myStream.Subscribe(makeTestConsumer[MyEvent](&received))
 
-		// give time for listener to be set-up properly
-		time.Sleep(10 * time.Millisecond)
-
 		err := myStream.Publish(context.Background(), MyEvent{Name: "John"})
 		require.NoError(t, err)
 
@@ -41,9 +38,6 @@ func TestEventStore_with_custom_events(t *testing.T) {
 		myStream := customEventStore.GetStream("my-custom-event-stream")
 		myStream.Subscribe(makeTestConsumer[MyEvent](&received))
 
-		// give time for listener to be set-up properly
-		time.Sleep(10 * time.Millisecond)
-
 		err := myStream.WithType("my_event").Publish(context.Background(), MyEvent{Name: "John"})
 		require.NoError(t, err)
 
@@ -55,9 +49,6 @@ func TestEventStore_with_custom_events(t *testing.T) {
 		myStream := customEventStore.GetStream("my-custom-event-stream")
 		myStream.Subscribe(makeTestConsumer[MyEvent](&received))
 
-		// give time for listener to be set-up properly
-		time.Sleep(10 * time.Millisecond)
-
 		err := myStream.ExpectedVersion("").Publish(context.Background(), MyEvent{Name: "Rose"})
 		require.NoError(t, err)
 
@@ -72,9 +63,6 @@ func TestEventStore_with_custom_events(t *testing.T) {
 		myStream := customEventStore.GetStream("my-incredible-stream")
 		myStream.Subscribe(makeTestConsumer[MyEvent](&received))
 
-		// give time for listener to be set-up properly
-		time.Sleep(10 * time.Millisecond)
-
 		err := myStream.ExpectedVersion("").WithType("my_event_type").Publish(context.Background(), MyEvent{Name: "Felipe"})
 		require.NoError(t, err)
 
@@ -86,9 +74,6 @@ func TestEventStore_with_custom_events(t *testing.T) {
 		myStream := customEventStore.GetStream("my-custom-event-stream")
 		myStream.Subscribe(makeTestConsumer[MyEvent](&received))
 
-		// give time for listener to be set-up properly
-		time.Sleep(10 * time.Millisecond)
-
 		err := myStream.ExpectedVersion("").Publish(context.Background(), MyEvent{Name: "Rose"})
 		require.NoError(t, err)
 
@@ -0,0 +1,112 @@
+package eventstore_test
+
+import (
+	"context"
+	"errors"
+	"github.com/nbarbey/go-event-store/eventstore"
+	"github.com/nbarbey/go-event-store/eventstore/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type addItem struct{ Price int }
+
+var errCartFull = errors.New("cart is full")
+
+func decideAddItem(c cart, command addItem) ([]cartEvent, error) {
+	if c.Items >= 2 {
+		return nil, errCartFull
+	}
+	return []cartEvent{itemAdded{Price: command.Price}}, nil
+}
+
+func loadCart(t *testing.T, es *eventstore.EventStore[cartEvent], streamName string) cart {
+	events, err := es.GetStream(streamName).Listener.All(context.Background())
+	require.NoError(t, err)
+	var c cart
+	for _, e := range events {
+		c = applyCartEvent(c, e)
+	}
+	return c
+}
+
+func TestDecider(t *testing.T) {
+	t.Run("decide and append", func(t *testing.T) {
+		es := newCartEventStore()
+		decider := eventstore.NewDecider(es, decideAddItem, applyCartEvent).WithTypeHints(cartTypeHint)
+
+		events, err := decider.Handle(context.Background(), "cart-1", addItem{Price: 10})
+		require.NoError(t, err)
+		assert.Equal(t, []cartEvent{itemAdded{Price: 10}}, events)
+		_, err = decider.Handle(context.Background(), "cart-1", addItem{Price: 5})
+		require.NoError(t, err)
+
+		assert.Equal(t, cart{Items: 2, Total: 15}, loadCart(t, es, "cart-1"))
+	})
+
+	t.Run("rejected command appends nothing", func(t *testing.T) {
+		es := newCartEventStore()
+		decider := eventstore.NewDecider(es, decideAddItem, applyCartEvent).WithTypeHints(cartTypeHint)
+		for range 2 {
+			_, err := decider.Handle(context.Background(), "cart-1", addItem{Price: 10})
+			require.NoError(t, err)
+		}
+
+		_, err := decider.Handle(context.Background(), "cart-1", addItem{Price: 10})
+		assert.ErrorIs(t, err, errCartFull)
+		assert.Equal(t, cart{Items: 2, Total: 20}, loadCart(t, es, "cart-1"))
+	})
+
+	t.Run("retry on conflicting append", func(t *testing.T) {
+		es := newCartEventStore()
+		require.NoError(t, es.GetStream("cart-1").WithType("itemAdded").Publish(context.Background(), itemAdded{Price: 1}))
+		concurrentWrites := 1
+		decider := eventstore.NewDecider(es, func(c cart, command addItem) ([]cartEvent, error) {
+			if concurrentWrites > 0 {
+				concurrentWrites--
+				require.NoError(t, es.GetStream("cart-1").WithType("itemAdded").Publish(context.Background(), itemAdded{Price: 2}))
+			}
+			return decideAddItem(c, command)
+		}, applyCartEvent).WithTypeHints(cartTypeHint)
+
+		_, err := decider.Handle(context.Background(), "cart-1", addItem{Price: 10})
+
+		assert.ErrorIs(t, err, errCartFull)
+		assert.Equal(t, cart{Items: 2, Total: 3}, loadCart(t, es, "cart-1"))
+	})
+
+	t.Run("retry when the stream is created concurrently", func(t *testing.T) {
+		es := newCartEventStore()
+		attempts := 0
+		decider := eventstore.NewDecider(es, func(c cart, command addItem) ([]cartEvent, error) {
+			attempts++
+			if attempts == 1 {
+				require.NoError(t, es.GetStream("cart-1").WithType("itemAdded").Publish(context.Background(), itemAdded{Price: 1}))
+			}
+			return []cartEvent{itemAdded{Price: command.Price}, itemAdded{Price: command.Price}}, nil
+		}, applyCartEvent).WithTypeHints(cartTypeHint)
+
+		_, err := decider.Handle(context.Background(), "cart-1", addItem{Price: 10})
+
+		require.NoError(t, err)
+		assert.Equal(t, 2, attempts)
+		assert.Equal(t, cart{Items: 3, Total: 21}, loadCart(t, es, "cart-1"))
+	})
+
+	t.Run("give up after too many conflicts", func(t *testing.T) {
+		es := newCartEventStore()
+		require.NoError(t, es.GetStream("cart-1").WithType("itemAdded").Publish(context.Background(), itemAdded{Price: 1}))
+		attempts := 0
+		decider := eventstore.NewDecider(es, func(c cart, command addItem) ([]cartEvent, error) {
+			attempts++
+			require.NoError(t, es.GetStream("cart-1").WithType("itemRemoved").Publish(context.Background(), itemRemoved{Price: 1}))
+			return []cartEvent{itemAdded{Price: command.Price}}, nil
+		}, applyCartEvent).WithTypeHints(cartTypeHint).WithMaxRetries(2)
+
+		_, err := decider.Handle(context.Background(), "cart-1", addItem{Price: 10})
+
+		assert.ErrorIs(t, err, repository.ErrVersionMismatch)
+		assert.Equal(t, 3, attempts)
+	})
+}
@@ -0,0 +1,149 @@
+package eventstore_test
+
+import (
+	"context"
+	"github.com/nbarbey/go-event-store/eventstore"
+	"github.com/nbarbey/go-event-store/eventstore/codec"
+	"github.com/nbarbey/go-event-store/eventstore/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestEventStore_events(t *testing.T) {
+	t.Run("receive events on a channel", func(t *testing.T) {
+		es := eventstore.NewInMemoryEventStore[string]()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events, errs := es.GetStream("channel-stream").Events(ctx, eventstore.EventsOptions{})
+
+		require.NoError(t, es.GetStream("channel-stream").Publish(context.Background(), "hello"))
+
+		select {
+		case envelope := <-events:
+			assert.Equal(t, "hello", envelope.Event)
+			assert.Equal(t, "channel-stream", envelope.StreamID)
+		case err := <-errs:
+			t.Fatal(err)
+		case <-time.After(time.Second):
+			t.Fatal("no event received")
+		}
+	})
+
+	t.Run("channels are closed when context is cancelled", func(t *testing.T) {
+		es := eventstore.NewInMemoryEventStore[string]()
+		ctx, cancel := context.WithCancel(context.Background())
+		events, errs := es.Events(ctx, eventstore.EventsOptions{})
+
+		cancel()
+
+		assert.Eventually(t, func() bool {
+			_, eventsOpen := <-events
+			_, errsOpen := <-errs
+			return !eventsOpen && !errsOpen
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("receive decoding errors", func(t *testing.T) {
+		r := repository.NewInMemory()
+		es := eventstore.NewEventStoreFromRepository(repository.NewTypedRepository[int](r, codec.NewJSONCodecWithTypeHints[int](nil)))
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		_, errs := es.Events(ctx, eventstore.EventsOptions{})
+
+		_, err := r.Stream("default-stream").InsertRawEvent(context.Background(), repository.RawEvent{Payload: []byte("not json")}, "")
+		require.NoError(t, err)
+
+		select {
+		case err := <-errs:
+			assert.Error(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("no error received")
+		}
+	})
+
+	t.Run("publishing does not wait for the reader", func(t *testing.T) {
+		es := eventstore.NewInMemoryEventStore[string]()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events, errs := es.Events(ctx, eventstore.EventsOptions{BufferSize: 1})
+
+		// published from the goroutine reading the events
+		for _, e := range []string{"one", "two", "three"} {
+			require.NoError(t, es.Publish(context.Background(), e))
+		}
+
+		var received []string
+		for len(received) < 3 {
+			select {
+			case envelope := <-events:
+				received = append(received, envelope.Event)
+			case err := <-errs:
+				t.Fatal(err)
+			case <-time.After(time.Second):
+				t.Fatal("no event received")
+			}
+		}
+		assert.Equal(t, []string{"one", "two", "three"}, received)
+	})
+
+	t.Run("cancelling while events are pending closes the channels", func(t *testing.T) {
+		es := eventstore.NewInMemoryEventStore[string]()
+		ctx, cancel := context.WithCancel(context.Background())
+		events, errs := es.Events(ctx, eventstore.EventsOptions{BufferSize: 1})
+		for _, e := range []string{"one", "two", "three"} {
+			require.NoError(t, es.Publish(context.Background(), e))
+		}
+
+		cancel()
+		require.NoError(t, es.Publish(context.Background(), "four"))
+
+		for range events {
+		}
+		for range errs {
+		}
+	})
+
+	t.Run("several decoding errors do not block publishing", func(t *testing.T) {
+		r := repository.NewInMemory()
+		es := eventstore.NewEventStoreFromRepository(repository.NewTypedRepository[int](r, codec.NewJSONCodecWithTypeHints[int](nil)))
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events, errs := es.Events(ctx, eventstore.EventsOptions{})
+
+		for i := 0; i < 2; i++ {
+			_, err := r.Stream("default-stream").InsertRawEvent(context.Background(), repository.RawEvent{Payload: []byte("not json")}, "")
+			require.NoError(t, err)
+		}
+		require.NoError(t, es.Publish(context.Background(), 42))
+
+		for i := 0; i < 2; i++ {
+			var decodeErr *repository.DecodeError
+			assert.ErrorAs(t, <-errs, &decodeErr)
+		}
+		assert.Equal(t, 42, (<-events).Event)
+	})
+
+	t.Run("iterate over events", func(t *testing.T) {
+		es := eventstore.NewInMemoryEventStore[string]()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		seq := es.EventsSeq(ctx, eventstore.EventsOptions{})
+
+		// published before iterating
+		for _, e := range []string{"one", "two", "three"} {
+			require.NoError(t, es.Publish(context.Background(), e))
+		}
+
+		var received []string
+		for envelope, err := range seq {
+			require.NoError(t, err)
+			received = append(received, envelope.Event)
+			if len(received) == 3 {
+				break
+			}
+		}
+		assert.Equal(t, []string{"one", "two", "three"}, received)
+	})
+}
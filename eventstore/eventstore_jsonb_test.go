@@ -0,0 +1,45 @@
+package eventstore_test
+
+import (
+	"context"
+	"github.com/nbarbey/go-event-store/eventstore"
+	"github.com/nbarbey/go-event-store/eventstore/codec"
+	"github.com/nbarbey/go-event-store/eventstore/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type paymentReceived struct {
+	Amount   int
+	Currency string
+}
+
+func TestEventStore_query_jsonb_payloads(t *testing.T) {
+	ctx := context.Background()
+	pg, err := repository.NewPostgres(ctx, postgresContainer.ConnectionString("search_path=payments_events"))
+	require.NoError(t, err)
+	require.NoError(t, pg.CreateJSONBIndex(ctx))
+	es := eventstore.NewEventStoreFromRepository(repository.NewTypedRepository[paymentReceived](pg.WithJSONBPayloads(), codec.NewJSONCodecWithTypeHints[paymentReceived](nil)))
+	for _, payment := range []paymentReceived{{Amount: 500, Currency: "EUR"}, {Amount: 1500, Currency: "EUR"}, {Amount: 2500, Currency: "USD"}} {
+		require.NoError(t, es.GetStream("payments").Publish(ctx, payment))
+	}
+
+	envelopes, err := es.GetStream("payments").Listener.QueryEnvelopes(ctx, "$.Amount > 1000", 0, 0)
+	require.NoError(t, err)
+
+	require.Len(t, envelopes, 2)
+	assert.Equal(t, paymentReceived{Amount: 1500, Currency: "EUR"}, envelopes[0].Event)
+	assert.Equal(t, paymentReceived{Amount: 2500, Currency: "USD"}, envelopes[1].Event)
+	events, err := es.GetStream("payments").Listener.All(ctx)
+	require.NoError(t, err)
+	assert.Len(t, events, 3)
+}
+
+func TestEventStore_query_without_jsonb(t *testing.T) {
+	es := eventstore.NewEventStoreFromRepository(repository.NewTypedRepository[paymentReceived](repository.NewInMemory(), codec.NewJSONCodecWithTypeHints[paymentReceived](nil)))
+
+	_, err := es.Listener.QueryEnvelopes(context.Background(), "$.Amount > 1000", 0, 0)
+
+	assert.ErrorIs(t, err, repository.ErrJSONQueryNotSupported)
+}
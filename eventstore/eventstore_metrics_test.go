@@ -0,0 +1,171 @@
+package eventstore_test
+
+import (
+	"context"
+	"github.com/nbarbey/go-event-store/eventstore"
+	"github.com/nbarbey/go-event-store/eventstore/codec"
+	"github.com/nbarbey/go-event-store/eventstore/consumer"
+	"github.com/nbarbey/go-event-store/eventstore/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEventStore_subscription_metrics(t *testing.T) {
+	t.Run("report lag of a paused subscription", func(t *testing.T) {
+		es := eventstore.NewInMemoryEventStore[string]()
+		publishAll(t, es.Publisher, "zero")
+		subscription, err := es.Subscribe(&recordingConsumer{})
+		require.NoError(t, err)
+		defer subscription.Cancel()
+
+		publishAll(t, es.Publisher, "one")
+		subscription.Pause()
+		publishAll(t, es.Publisher, "two", "three")
+
+		metrics, err := subscription.Metrics(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), metrics.Position)
+		assert.Equal(t, int64(4), metrics.HeadPosition)
+		assert.Equal(t, int64(2), metrics.LagEvents)
+		assert.Greater(t, metrics.LagSeconds, 0.0)
+		assert.Equal(t, uint64(1), metrics.Handled)
+		assert.Equal(t, uint64(1), metrics.Latency.Count)
+
+		require.NoError(t, subscription.Resume())
+		metrics, err = subscription.Metrics(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), metrics.LagEvents)
+		assert.Equal(t, 0.0, metrics.LagSeconds)
+		assert.Equal(t, uint64(3), metrics.Handled)
+	})
+
+	t.Run("batch subscriptions count events once consumed", func(t *testing.T) {
+		es := eventstore.NewInMemoryEventStore[string]()
+		consuming, release := make(chan []string, 1), make(chan struct{})
+		subscription, err := es.SubscribeBatch(consumer.BatchConsumerFunc[string](func(events []string) {
+			consuming <- events
+			<-release
+		}), eventstore.BatchOptions{MaxSize: 3})
+		require.NoError(t, err)
+		defer subscription.Cancel()
+
+		publishAll(t, es.Publisher, "one", "two", "three")
+		assert.Len(t, <-consuming, 3)
+		metrics, err := subscription.Metrics(context.Background())
+		require.NoError(t, err)
+		assert.Zero(t, metrics.Handled)
+		assert.Zero(t, metrics.Latency.Count)
+		assert.Equal(t, int64(0), metrics.Position)
+		assert.Equal(t, int64(3), metrics.LagEvents)
+
+		close(release)
+		assert.Eventually(t, func() bool {
+			metrics, err := subscription.Metrics(context.Background())
+			require.NoError(t, err)
+			return metrics.Handled == 3 && metrics.Latency.Count == 1 && metrics.Position == 3 && metrics.LagEvents == 0
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("parallel subscriptions report the position of the oldest event being consumed", func(t *testing.T) {
+		es := eventstore.NewInMemoryEventStore[string]()
+		consuming, release := make(chan string, 3), make(chan struct{})
+		subscription, err := es.SubscribeParallel(consumer.ConsumerFunc[string](func(event string) {
+			consuming <- event
+			if event == "slow" {
+				<-release
+			}
+		}), eventstore.ParallelOptions[string]{Workers: 2, Key: func(envelope repository.Envelope[string]) string { return envelope.Event }})
+		require.NoError(t, err)
+		defer subscription.Cancel()
+
+		publishAll(t, es.Publisher, "slow", "fast")
+		assert.ElementsMatch(t, []string{"slow", "fast"}, []string{<-consuming, <-consuming})
+		assert.Eventually(t, func() bool {
+			metrics, err := subscription.Metrics(context.Background())
+			require.NoError(t, err)
+			return metrics.Handled == 1
+		}, time.Second, time.Millisecond)
+		metrics, err := subscription.Metrics(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), metrics.Position)
+		assert.Equal(t, int64(2), metrics.LagEvents)
+
+		close(release)
+		assert.Eventually(t, func() bool {
+			metrics, err := subscription.Metrics(context.Background())
+			require.NoError(t, err)
+			return metrics.Position == 2 && metrics.LagEvents == 0
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("export metrics in prometheus format", func(t *testing.T) {
+		es := eventstore.NewInMemoryEventStore[string]()
+		subscription, err := es.Subscribe(&recordingConsumer{})
+		require.NoError(t, err)
+		defer subscription.Cancel()
+		publishAll(t, es.Publisher, "one")
+		registry := eventstore.NewMetricsRegistry()
+		registry.Register("my-projection", subscription)
+
+		recorder := httptest.NewRecorder()
+		eventstore.NewPrometheusExporter(registry).ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+		body := recorder.Body.String()
+		assert.Contains(t, body, "# TYPE eventstore_subscription_lag_events gauge\n")
+		assert.Contains(t, body, `eventstore_subscription_position{subscription="my-projection"} 1`)
+		assert.Contains(t, body, `eventstore_subscription_events_total{subscription="my-projection"} 1`)
+		assert.Contains(t, body, `eventstore_subscription_handler_seconds_bucket{subscription="my-projection",le="+Inf"} 1`)
+		assert.Contains(t, body, `eventstore_subscription_handler_seconds_count{subscription="my-projection"} 1`)
+	})
+
+	t.Run("export the metrics of the other subscriptions when one fails", func(t *testing.T) {
+		failing := &failingHead{Repository: repository.NewInMemory(), failed: &atomic.Bool{}}
+		broken, err := eventstore.NewEventStoreFromRepository(repository.NewTypedRepository[string](failing, codec.NewJSONCodecWithTypeHints[string](nil))).Subscribe(&recordingConsumer{})
+		require.NoError(t, err)
+		defer broken.Cancel()
+		es := eventstore.NewInMemoryEventStore[string]()
+		subscription, err := es.Subscribe(&recordingConsumer{})
+		require.NoError(t, err)
+		defer subscription.Cancel()
+		publishAll(t, es.Publisher, "one")
+		registry := eventstore.NewMetricsRegistry()
+		registry.Register("broken", broken)
+		registry.Register("my-projection", subscription)
+		failing.failed.Store(true)
+
+		recorder := httptest.NewRecorder()
+		eventstore.NewPrometheusExporter(registry).ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		body := recorder.Body.String()
+		assert.Contains(t, body, `eventstore_subscription_position{subscription="my-projection"} 1`)
+		assert.NotContains(t, body, `subscription="broken"`)
+		assert.ErrorIs(t, registry.CollectTo(context.Background(), &noCollector{}), errHeadUnavailable)
+	})
+}
+
+// failingHead fails to read the head position of the repository it wraps once failed.
+type failingHead struct {
+	repository.Repository
+	failed *atomic.Bool
+}
+
+func (r *failingHead) Stream(name string) repository.Repository {
+	return &failingHead{Repository: r.Repository.Stream(name), failed: r.failed}
+}
+
+func (r *failingHead) HeadPosition(ctx context.Context) (int64, error) {
+	if r.failed.Load() {
+		return 0, errHeadUnavailable
+	}
+	return r.Repository.HeadPosition(ctx)
+}
+
+type noCollector struct{}
+
+func (noCollector) Collect(string, eventstore.SubscriptionMetrics) {}
@@ -0,0 +1,112 @@
+package eventstore_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/nbarbey/go-event-store/eventstore"
+	"github.com/nbarbey/go-event-store/eventstore/codec"
+	"github.com/nbarbey/go-event-store/eventstore/consumer"
+	"github.com/nbarbey/go-event-store/eventstore/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type counted struct {
+	Stream string
+	Count  int
+}
+
+func TestEventStore_parallel_subscription(t *testing.T) {
+	t.Run("preserve order within a stream", func(t *testing.T) {
+		es := eventstore.NewInMemoryEventStore[counted]()
+		var mutex sync.Mutex
+		received := make(map[string][]int)
+		subscription, err := es.GetStream(repository.CategoryStream("counter")).
+			SubscribeParallel(consumer.ConsumerFunc[counted](func(e counted) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				received[e.Stream] = append(received[e.Stream], e.Count)
+			}), eventstore.ParallelOptions[counted]{Workers: 4})
+		require.NoError(t, err)
+		defer subscription.Cancel()
+
+		for i := 0; i < 10; i++ {
+			for _, name := range []string{"counter-a", "counter-b", "counter-c"} {
+				require.NoError(t, es.GetStream(name).Publish(context.Background(), counted{Stream: name, Count: i}))
+			}
+		}
+
+		expected := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+		assert.Eventually(t, func() bool {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return len(received["counter-a"]) == 10 && len(received["counter-b"]) == 10 && len(received["counter-c"]) == 10
+		}, time.Second, time.Millisecond)
+		assert.Equal(t, expected, received["counter-a"])
+		assert.Equal(t, expected, received["counter-b"])
+		assert.Equal(t, expected, received["counter-c"])
+	})
+
+	t.Run("process different keys in parallel", func(t *testing.T) {
+		es := eventstore.NewInMemoryEventStore[counted]()
+		unblock := make(chan struct{})
+		done := make(chan string, 2)
+		subscription, err := es.GetStream(repository.AllStreams).
+			SubscribeParallel(consumer.ConsumerFunc[counted](func(e counted) {
+				if e.Stream == "blocked" {
+					<-unblock
+				} else {
+					close(unblock)
+				}
+				done <- e.Stream
+			}), eventstore.ParallelOptions[counted]{
+				Workers: 2,
+				Key: func(envelope repository.Envelope[counted]) string {
+					return fmt.Sprint(envelope.Event.Stream == "blocked")
+				},
+			})
+		require.NoError(t, err)
+		defer subscription.Cancel()
+
+		require.NoError(t, es.GetStream("blocked").Publish(context.Background(), counted{Stream: "blocked"}))
+		require.NoError(t, es.GetStream("unblocking").Publish(context.Background(), counted{Stream: "unblocking"}))
+
+		for i := 0; i < 2; i++ {
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("events with different keys were not consumed in parallel")
+			}
+		}
+	})
+
+	t.Run("limit events in flight", func(t *testing.T) {
+		c := &countingCodec{JSONCodecWithTypeHints: codec.NewJSONCodecWithTypeHints[int](nil)}
+		es := eventstore.NewEventStoreFromRepository(repository.NewTypedRepository[int](repository.NewInMemory(), c))
+		release := make(chan struct{})
+		var consumed atomic.Int32
+		subscription, err := es.GetStream(repository.AllStreams).
+			SubscribeParallel(consumer.ConsumerFunc[int](func(e int) {
+				<-release
+				consumed.Add(1)
+			}), eventstore.ParallelOptions[int]{Workers: 2, MaxInFlight: 3})
+		require.NoError(t, err)
+		defer subscription.Cancel()
+
+		// publishing does not wait for the blocked workers
+		for i := 0; i < 10; i++ {
+			require.NoError(t, es.GetStream(fmt.Sprintf("limited-%d", i)).Publish(context.Background(), i))
+		}
+
+		// events 1 to 3 are in flight, and fetching waits to dispatch 4 with its page of 3
+		assert.Eventually(t, func() bool { return subscription.Position() == 4 }, time.Second, time.Millisecond)
+		assert.Equal(t, int32(6), c.decoded.Load())
+		close(release)
+		assert.Eventually(t, func() bool { return consumed.Load() == 10 }, time.Second, time.Millisecond)
+		assert.Equal(t, int32(10), c.decoded.Load())
+	})
+}
@@ -0,0 +1,201 @@
+package eventstore_test
+
+import (
+	"context"
+	"errors"
+	"github.com/nbarbey/go-event-store/eventstore"
+	"github.com/nbarbey/go-event-store/eventstore/codec"
+	"github.com/nbarbey/go-event-store/eventstore/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type bankEvent interface{ transferID() string }
+
+type transferRequested struct {
+	TransferID, From, To string
+	Amount               int
+}
+
+type accountDebited struct {
+	TransferID string
+	Amount     int
+}
+
+type debitRejected struct{ TransferID string }
+
+type accountCredited struct{ TransferID string }
+
+type creditRejected struct{ TransferID string }
+
+type debitRefunded struct{ TransferID string }
+
+func (e transferRequested) transferID() string { return e.TransferID }
+func (e accountDebited) transferID() string    { return e.TransferID }
+func (e debitRejected) transferID() string     { return e.TransferID }
+func (e accountCredited) transferID() string   { return e.TransferID }
+func (e creditRejected) transferID() string    { return e.TransferID }
+func (e debitRefunded) transferID() string     { return e.TransferID }
+
+func addBankEvent[T bankEvent](m codec.UnmarshallerMap[bankEvent], typeHint string) codec.UnmarshallerMap[bankEvent] {
+	return m.AddFunc(typeHint, func(payload []byte) (bankEvent, error) {
+		return codec.BuildJSONUnmarshalFunc[T]()(payload)
+	})
+}
+
+func newBankEventStore() (*repository.InMemory, *eventstore.EventStore[bankEvent]) {
+	m := codec.NewUnmarshallerMap[bankEvent]()
+	addBankEvent[transferRequested](m, "transferRequested")
+	addBankEvent[accountDebited](m, "accountDebited")
+	addBankEvent[debitRejected](m, "debitRejected")
+	addBankEvent[accountCredited](m, "accountCredited")
+	addBankEvent[creditRejected](m, "creditRejected")
+	addBankEvent[debitRefunded](m, "debitRefunded")
+	r := repository.NewInMemory()
+	return r, eventstore.NewEventStoreFromRepository(repository.NewTypedRepository[bankEvent](r, codec.NewJSONCodecWithTypeHints[bankEvent](m)))
+}
+
+type bankCommand struct {
+	Kind       string
+	TransferID string
+	Account    string
+	Amount     int
+}
+
+type transfer struct {
+	From, To string
+	Amount   int
+	Status   string
+}
+
+type transferSaga struct{}
+
+func (transferSaga) Correlate(envelope repository.Envelope[bankEvent]) (string, bool) {
+	return envelope.Event.transferID(), true
+}
+
+func (transferSaga) Handle(t transfer, envelope repository.Envelope[bankEvent]) (transfer, []bankCommand, error) {
+	switch e := envelope.Event.(type) {
+	case transferRequested:
+		t = transfer{From: e.From, To: e.To, Amount: e.Amount, Status: "debiting"}
+		return t, []bankCommand{{Kind: "debit", TransferID: e.TransferID, Account: t.From, Amount: t.Amount}}, nil
+	case accountDebited:
+		t.Status = "crediting"
+		return t, []bankCommand{{Kind: "credit", TransferID: e.TransferID, Account: t.To, Amount: t.Amount}}, nil
+	case debitRejected:
+		t.Status = "failed"
+	case accountCredited:
+		t.Status = "completed"
+	case creditRejected:
+		t.Status = "compensating"
+		return t, []bankCommand{{Kind: "refund", TransferID: e.TransferID, Account: t.From, Amount: t.Amount}}, nil
+	case debitRefunded:
+		t.Status = "refunded"
+	}
+	return t, nil, nil
+}
+
+// bank executes commands by appending their outcome to the account streams.
+type bank struct {
+	es         *eventstore.EventStore[bankEvent]
+	dispatched []bankCommand
+}
+
+func (b *bank) Dispatch(ctx context.Context, command bankCommand) error {
+	b.dispatched = append(b.dispatched, command)
+	stream := b.es.GetStream("account-" + command.Account)
+	switch {
+	case command.Kind == "debit" && command.Account == "empty":
+		return stream.WithType("debitRejected").Publish(ctx, debitRejected{TransferID: command.TransferID})
+	case command.Kind == "debit":
+		return stream.WithType("accountDebited").Publish(ctx, accountDebited{TransferID: command.TransferID, Amount: command.Amount})
+	case command.Kind == "credit" && command.Account == "closed":
+		return stream.WithType("creditRejected").Publish(ctx, creditRejected{TransferID: command.TransferID})
+	case command.Kind == "credit":
+		return stream.WithType("accountCredited").Publish(ctx, accountCredited{TransferID: command.TransferID})
+	case command.Kind == "refund":
+		return stream.WithType("debitRefunded").Publish(ctx, debitRefunded{TransferID: command.TransferID})
+	}
+	return errors.New("unknown command")
+}
+
+func transferStatus(t *testing.T, transfers *eventstore.ProcessManager[transfer, bankEvent, bankCommand], id string) func() string {
+	return func() string {
+		state, err := transfers.State(context.Background(), id)
+		require.NoError(t, err)
+		return state.Status
+	}
+}
+
+func TestProcessManager(t *testing.T) {
+	run := func(t *testing.T, from, to, expectedStatus string) *bank {
+		r, es := newBankEventStore()
+		b := &bank{es: es}
+		transfers := eventstore.NewProcessManager[transfer, bankEvent, bankCommand](es, "transfers", transferSaga{}, codec.NewJSONCodec[transfer](), b)
+		d := eventstore.NewProjectionDaemon(es, r)
+		require.NoError(t, d.Register(transfers.Name(), transfers, eventstore.AsyncProjectionOptions{Stream: repository.CategoryStream("account"), PollInterval: 10 * time.Millisecond}))
+		stop := runDaemon(d)
+		defer stop()
+
+		require.NoError(t, es.GetStream("account-"+from).WithType("transferRequested").Publish(context.Background(),
+			transferRequested{TransferID: "t1", From: from, To: to, Amount: 10}))
+
+		assert.Eventually(t, func() bool { return transferStatus(t, transfers, "t1")() == expectedStatus }, time.Second, time.Millisecond)
+		return b
+	}
+
+	t.Run("complete a transfer", func(t *testing.T) {
+		b := run(t, "alice", "bob", "completed")
+		assert.Equal(t, []bankCommand{
+			{Kind: "debit", TransferID: "t1", Account: "alice", Amount: 10},
+			{Kind: "credit", TransferID: "t1", Account: "bob", Amount: 10},
+		}, b.dispatched)
+	})
+
+	t.Run("fail a transfer", func(t *testing.T) {
+		run(t, "empty", "bob", "failed")
+	})
+
+	t.Run("compensate a transfer", func(t *testing.T) {
+		b := run(t, "alice", "closed", "refunded")
+		assert.Equal(t, "refund", b.dispatched[2].Kind)
+	})
+
+	t.Run("state is persisted in its own stream, out of $all", func(t *testing.T) {
+		r, es := newBankEventStore()
+		transfers := eventstore.NewProcessManager[transfer, bankEvent, bankCommand](es, "transfers", transferSaga{}, codec.NewJSONCodec[transfer](), &bank{es: es})
+		require.NoError(t, es.GetStream("account-alice").WithType("transferRequested").Publish(context.Background(),
+			transferRequested{TransferID: "t1", From: "alice", To: "bob", Amount: 10}))
+		envelopes, err := es.GetStream("account-alice").Listener.ReadEnvelopes(context.Background(), 0, 0)
+		require.NoError(t, err)
+
+		require.NoError(t, transfers.Apply(context.Background(), nil, envelopes))
+
+		states, err := r.Stream(transfers.StreamName("t1")).AllRawEvents(context.Background())
+		require.NoError(t, err)
+		require.Len(t, states, 1)
+		assert.Equal(t, strconv.FormatInt(envelopes[0].Position, 10), states[0].Version)
+		assert.JSONEq(t, `{"From":"alice","To":"bob","Amount":10,"Status":"debiting"}`, string(states[0].Payload))
+		all, err := es.GetStream(repository.AllStreams).Listener.ReadEnvelopes(context.Background(), 0, 0)
+		require.NoError(t, err)
+		assert.Len(t, all, 2)
+	})
+
+	t.Run("redelivered events are not handled twice", func(t *testing.T) {
+		_, es := newBankEventStore()
+		b := &bank{es: es}
+		transfers := eventstore.NewProcessManager[transfer, bankEvent, bankCommand](es, "transfers", transferSaga{}, codec.NewJSONCodec[transfer](), b)
+		require.NoError(t, es.GetStream("account-alice").WithType("transferRequested").Publish(context.Background(),
+			transferRequested{TransferID: "t1", From: "alice", To: "bob", Amount: 10}))
+		envelopes, err := es.GetStream("account-alice").Listener.ReadEnvelopes(context.Background(), 0, 1)
+		require.NoError(t, err)
+
+		require.NoError(t, transfers.Apply(context.Background(), nil, envelopes))
+		require.NoError(t, transfers.Apply(context.Background(), nil, envelopes))
+
+		assert.Len(t, b.dispatched, 1)
+	})
+}
@@ -0,0 +1,240 @@
+package eventstore_test
+
+import (
+	"context"
+	"errors"
+	"github.com/nbarbey/go-event-store/eventstore"
+	"github.com/nbarbey/go-event-store/eventstore/codec"
+	"github.com/nbarbey/go-event-store/eventstore/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+type wordCounts struct {
+	mutex   sync.Mutex
+	counts  map[string]int
+	batches int
+}
+
+func newWordCounts() *wordCounts {
+	return &wordCounts{counts: make(map[string]int)}
+}
+
+func (w *wordCounts) Apply(_ context.Context, _ repository.Tx, envelopes []repository.Envelope[string]) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.batches++
+	for _, envelope := range envelopes {
+		w.counts[envelope.StreamID]++
+	}
+	return nil
+}
+
+func (w *wordCounts) Reset(_ context.Context, _ repository.Tx) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.counts = make(map[string]int)
+	return nil
+}
+
+func (w *wordCounts) snapshot() map[string]int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	out := make(map[string]int, len(w.counts))
+	for k, v := range w.counts {
+		out[k] = v
+	}
+	return out
+}
+
+func newDaemonEventStore() (*repository.InMemory, *eventstore.EventStore[string]) {
+	r := repository.NewInMemory()
+	return r, eventstore.NewEventStoreFromRepository(repository.NewTypedRepository[string](r, codec.NewJSONCodecWithTypeHints[string](nil)))
+}
+
+func runDaemon[E any](d *eventstore.ProjectionDaemon[E]) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		_ = d.Run(ctx)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func caughtUp(t *testing.T, d *eventstore.ProjectionDaemon[string]) func() bool {
+	return func() bool {
+		statuses, err := d.Status(context.Background())
+		require.NoError(t, err)
+		for _, status := range statuses {
+			if status.Position != status.HeadPosition || status.LastError != nil {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func TestProjectionDaemon(t *testing.T) {
+	t.Run("project a category in batches", func(t *testing.T) {
+		r, es := newDaemonEventStore()
+		publishAll(t, es.GetStream("word-1").Publisher, "a", "b", "c")
+		publishAll(t, es.GetStream("word-2").Publisher, "d")
+		publishAll(t, es.GetStream("number-1").Publisher, "1")
+
+		counts := newWordCounts()
+		d := eventstore.NewProjectionDaemon(es, r)
+		require.NoError(t, d.Register("word-counts", counts, eventstore.AsyncProjectionOptions{Stream: repository.CategoryStream("word"), BatchSize: 2}))
+		stop := runDaemon(d)
+		defer stop()
+
+		assert.Eventually(t, caughtUp(t, d), time.Second, time.Millisecond)
+		assert.Equal(t, map[string]int{"word-1": 3, "word-2": 1}, counts.snapshot())
+		assert.Equal(t, 2, counts.batches)
+
+		publishAll(t, es.GetStream("word-2").Publisher, "e")
+		assert.Eventually(t, func() bool { return counts.snapshot()["word-2"] == 2 }, time.Second, time.Millisecond)
+	})
+
+	t.Run("report status", func(t *testing.T) {
+		r, es := newDaemonEventStore()
+		publishAll(t, es.GetStream("word-1").Publisher, "a", "b")
+		d := eventstore.NewProjectionDaemon(es, r)
+		require.NoError(t, d.Register("word-counts", newWordCounts(), eventstore.AsyncProjectionOptions{}))
+
+		statuses, err := d.Status(context.Background())
+		require.NoError(t, err)
+		require.Len(t, statuses, 1)
+		assert.Equal(t, eventstore.ProjectionStatus{Name: "word-counts", Active: true, Stream: repository.AllStreams, HeadPosition: 2}, statuses[0])
+
+		stop := runDaemon(d)
+		assert.Eventually(t, caughtUp(t, d), time.Second, time.Millisecond)
+		statuses, err = d.Status(context.Background())
+		require.NoError(t, err)
+		assert.True(t, statuses[0].Running)
+		assert.Equal(t, int64(2), statuses[0].Position)
+		assert.False(t, statuses[0].UpdatedAt.IsZero())
+
+		stop()
+		statuses, err = d.Status(context.Background())
+		require.NoError(t, err)
+		assert.False(t, statuses[0].Running)
+	})
+
+	t.Run("resume from the checkpoint", func(t *testing.T) {
+		r, es := newDaemonEventStore()
+		publishAll(t, es.GetStream("word-1").Publisher, "a", "b")
+		first := newWordCounts()
+		d := eventstore.NewProjectionDaemon(es, r)
+		require.NoError(t, d.Register("word-counts", first, eventstore.AsyncProjectionOptions{}))
+		stop := runDaemon(d)
+		assert.Eventually(t, caughtUp(t, d), time.Second, time.Millisecond)
+		stop()
+
+		publishAll(t, es.GetStream("word-1").Publisher, "c")
+		second := newWordCounts()
+		d = eventstore.NewProjectionDaemon(es, r)
+		require.NoError(t, d.Register("word-counts", second, eventstore.AsyncProjectionOptions{}))
+		stop = runDaemon(d)
+		defer stop()
+
+		assert.Eventually(t, caughtUp(t, d), time.Second, time.Millisecond)
+		assert.Equal(t, map[string]int{"word-1": 2}, first.snapshot())
+		assert.Equal(t, map[string]int{"word-1": 1}, second.snapshot())
+	})
+
+	t.Run("failing batch is retried without moving the checkpoint", func(t *testing.T) {
+		r, es := newDaemonEventStore()
+		publishAll(t, es.GetStream("word-1").Publisher, "a")
+		counts := newWordCounts()
+		var failures sync.WaitGroup
+		failures.Add(1)
+		failed := false
+		d := eventstore.NewProjectionDaemon(es, r)
+		require.NoError(t, d.Register("word-counts", eventstore.AsyncProjectionFunc[string](func(ctx context.Context, tx repository.Tx, envelopes []repository.Envelope[string]) error {
+			if !failed {
+				failed = true
+				failures.Done()
+				return errors.New("read model unavailable")
+			}
+			return counts.Apply(ctx, tx, envelopes)
+		}), eventstore.AsyncProjectionOptions{PollInterval: 50 * time.Millisecond}))
+		stop := runDaemon(d)
+		defer stop()
+
+		failures.Wait()
+		assert.Eventually(t, func() bool {
+			statuses, err := d.Status(context.Background())
+			require.NoError(t, err)
+			return statuses[0].LastError != nil && statuses[0].Position == 0
+		}, time.Second, time.Millisecond)
+		assert.Eventually(t, caughtUp(t, d), time.Second, time.Millisecond)
+		assert.Equal(t, map[string]int{"word-1": 1}, counts.snapshot())
+	})
+
+	t.Run("poison event is dead-lettered", func(t *testing.T) {
+		r, es := newDaemonEventStore()
+		publishAll(t, es.GetStream("word-1").Publisher, "a", "poison", "c")
+		counts := newWordCounts()
+		d := eventstore.NewProjectionDaemon(es, r)
+		require.NoError(t, d.Register("word-counts", eventstore.AsyncProjectionFunc[string](func(ctx context.Context, tx repository.Tx, envelopes []repository.Envelope[string]) error {
+			for _, envelope := range envelopes {
+				if envelope.Event == "poison" {
+					return errors.New("cannot count poison")
+				}
+			}
+			return counts.Apply(ctx, tx, envelopes)
+		}), eventstore.AsyncProjectionOptions{RetryBackoff: time.Millisecond, MaxAttempts: 2}))
+		stop := runDaemon(d)
+		defer stop()
+
+		assert.Eventually(t, caughtUp(t, d), time.Second, time.Millisecond)
+		assert.Equal(t, map[string]int{"word-1": 2}, counts.snapshot())
+		letters, err := d.DeadLetters(context.Background(), "word-counts")
+		require.NoError(t, err)
+		require.Len(t, letters, 1)
+		assert.Equal(t, int64(2), letters[0].Position)
+		assert.Equal(t, "cannot count poison", letters[0].Error)
+	})
+
+	t.Run("undecodable event is dead-lettered", func(t *testing.T) {
+		r, es := newDaemonEventStore()
+		publishAll(t, es.GetStream("word-1").Publisher, "a")
+		garbled, err := r.Stream("word-1").InsertRawEvent(context.Background(), repository.RawEvent{Payload: []byte("not json")}, "")
+		require.NoError(t, err)
+		publishAll(t, es.GetStream("word-1").Publisher, "c")
+		counts := newWordCounts()
+		d := eventstore.NewProjectionDaemon(es, r)
+		require.NoError(t, d.Register("word-counts", counts, eventstore.AsyncProjectionOptions{RetryBackoff: time.Millisecond, MaxAttempts: 2}))
+		stop := runDaemon(d)
+		defer stop()
+
+		assert.Eventually(t, caughtUp(t, d), time.Second, time.Millisecond)
+		assert.Equal(t, map[string]int{"word-1": 2}, counts.snapshot())
+		letters, err := d.DeadLetters(context.Background(), "word-counts")
+		require.NoError(t, err)
+		require.Len(t, letters, 1)
+		assert.Equal(t, int64(2), letters[0].Position)
+		assert.Equal(t, garbled, letters[0].EventID)
+	})
+
+	t.Run("register while running", func(t *testing.T) {
+		r, es := newDaemonEventStore()
+		publishAll(t, es.GetStream("word-1").Publisher, "a")
+		d := eventstore.NewProjectionDaemon(es, r)
+		stop := runDaemon(d)
+		defer stop()
+
+		counts := newWordCounts()
+		require.NoError(t, d.Register("word-counts", counts, eventstore.AsyncProjectionOptions{}))
+		assert.ErrorIs(t, d.Register("word-counts", counts, eventstore.AsyncProjectionOptions{}), eventstore.ErrProjectionAlreadyRegistered)
+
+		assert.Eventually(t, func() bool { return counts.snapshot()["word-1"] == 1 }, time.Second, time.Millisecond)
+	})
+}
@@ -0,0 +1,85 @@
+package eventstore_test
+
+import (
+	"context"
+	"errors"
+	"github.com/nbarbey/go-event-store/eventstore"
+	"github.com/nbarbey/go-event-store/eventstore/codec"
+	"github.com/nbarbey/go-event-store/eventstore/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestEventStore_inline_projections(t *testing.T) {
+	t.Run("read model is updated with the append", func(t *testing.T) {
+		es := eventstore.NewInMemoryEventStore[string]()
+		lengths := make(map[string]int)
+		_, err := es.AddInlineProjection(eventstore.InlineProjectionFunc[string](func(ctx context.Context, tx repository.Tx, envelope repository.Envelope[string]) error {
+			lengths[envelope.StreamID] += len(envelope.Event)
+			return nil
+		}))
+		require.NoError(t, err)
+
+		require.NoError(t, es.GetStream("words-1").Publish(context.Background(), "hello"))
+		require.NoError(t, es.GetStream("words-2").Publish(context.Background(), "world!"))
+
+		assert.Equal(t, map[string]int{"words-1": 5, "words-2": 6}, lengths)
+	})
+
+	t.Run("failing projection rejects the append", func(t *testing.T) {
+		es := eventstore.NewInMemoryEventStore[string]()
+		remove, err := es.AddInlineProjection(eventstore.InlineProjectionFunc[string](func(ctx context.Context, tx repository.Tx, envelope repository.Envelope[string]) error {
+			if envelope.Event == "" {
+				return errors.New("empty words are not allowed")
+			}
+			return nil
+		}))
+		require.NoError(t, err)
+
+		require.NoError(t, es.Publish(context.Background(), "hello"))
+		assert.Error(t, es.Publish(context.Background(), ""))
+
+		events, err := es.Listener.All(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []string{"hello"}, events)
+
+		remove()
+		assert.NoError(t, es.Publish(context.Background(), ""))
+	})
+
+	t.Run("projections read the store", func(t *testing.T) {
+		es := eventstore.NewInMemoryEventStore[string]()
+		var seen []int
+		_, err := es.AddInlineProjection(eventstore.InlineProjectionFunc[string](func(ctx context.Context, tx repository.Tx, envelope repository.Envelope[string]) error {
+			previous, err := es.GetStream(envelope.StreamID).Listener.All(ctx)
+			seen = append(seen, len(previous))
+			return err
+		}))
+		require.NoError(t, err)
+
+		require.NoError(t, es.GetStream("words").Publish(context.Background(), "hello"))
+		require.NoError(t, es.GetStream("words").Publish(context.Background(), "world"))
+
+		assert.Equal(t, []int{0, 1}, seen)
+	})
+
+	t.Run("repositories without inline projections", func(t *testing.T) {
+		es := eventstore.NewEventStoreFromRepository(repository.NewTypedRepository[string](withoutInlineProjections{repository.NewInMemory()}, codec.NewGobCodecWithTypeHints[string](nil)))
+
+		_, err := es.AddInlineProjection(eventstore.InlineProjectionFunc[string](func(context.Context, repository.Tx, repository.Envelope[string]) error {
+			return nil
+		}))
+
+		assert.ErrorIs(t, err, repository.ErrInlineProjectionsNotSupported)
+	})
+}
+
+// withoutInlineProjections hides the inline projections of the repository it wraps.
+type withoutInlineProjections struct {
+	repository.Repository
+}
+
+func (r withoutInlineProjections) Stream(name string) repository.Repository {
+	return withoutInlineProjections{r.Repository.Stream(name)}
+}
@@ -0,0 +1,110 @@
+package eventstore_test
+
+import (
+	"context"
+	"github.com/nbarbey/go-event-store/eventstore"
+	"github.com/nbarbey/go-event-store/eventstore/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestProjectionDaemon_versions(t *testing.T) {
+	t.Run("shadow version builds from the first event then is swapped in", func(t *testing.T) {
+		r, es := newDaemonEventStore()
+		publishAll(t, es.GetStream("word-1").Publisher, "a", "b")
+		blue, green := newWordCounts(), newWordCounts()
+		release := make(chan struct{})
+		d := eventstore.NewProjectionDaemon(es, r)
+		require.NoError(t, d.RegisterVersion("word-counts", 1, blue, eventstore.AsyncProjectionOptions{}))
+		stop := runDaemon(d)
+		defer stop()
+		assert.Eventually(t, caughtUp(t, d), time.Second, time.Millisecond)
+
+		require.NoError(t, d.RegisterVersion("word-counts", 2, eventstore.AsyncProjectionFunc[string](func(ctx context.Context, tx repository.Tx, envelopes []repository.Envelope[string]) error {
+			<-release
+			return green.Apply(ctx, tx, envelopes)
+		}), eventstore.AsyncProjectionOptions{}))
+
+		assert.ErrorIs(t, d.Swap(context.Background(), "word-counts"), eventstore.ErrProjectionNotCaughtUp)
+		active, err := d.Active(context.Background(), "word-counts")
+		require.NoError(t, err)
+		assert.Equal(t, 1, active)
+
+		close(release)
+		assert.Eventually(t, caughtUp(t, d), time.Second, time.Millisecond)
+		require.NoError(t, d.Swap(context.Background(), "word-counts"))
+
+		active, err = d.Active(context.Background(), "word-counts")
+		require.NoError(t, err)
+		assert.Equal(t, 2, active)
+		assert.Equal(t, map[string]int{"word-1": 2}, green.snapshot())
+
+		statuses, err := d.Status(context.Background())
+		require.NoError(t, err)
+		require.Len(t, statuses, 1)
+		assert.Equal(t, 2, statuses[0].Version)
+		assert.True(t, statuses[0].Active)
+
+		publishAll(t, es.GetStream("word-1").Publisher, "c")
+		assert.Eventually(t, func() bool { return green.snapshot()["word-1"] == 3 }, time.Second, time.Millisecond)
+		assert.Equal(t, map[string]int{"word-1": 2}, blue.snapshot())
+	})
+
+	t.Run("active version survives restarts", func(t *testing.T) {
+		r, es := newDaemonEventStore()
+		d := eventstore.NewProjectionDaemon(es, r)
+		require.NoError(t, d.RegisterVersion("word-counts", 1, newWordCounts(), eventstore.AsyncProjectionOptions{}))
+		require.NoError(t, d.RegisterVersion("word-counts", 2, newWordCounts(), eventstore.AsyncProjectionOptions{}))
+		require.NoError(t, d.Swap(context.Background(), "word-counts"))
+
+		d = eventstore.NewProjectionDaemon(es, r)
+		require.NoError(t, d.RegisterVersion("word-counts", 1, newWordCounts(), eventstore.AsyncProjectionOptions{}))
+		require.NoError(t, d.RegisterVersion("word-counts", 2, newWordCounts(), eventstore.AsyncProjectionOptions{}))
+
+		active, err := d.Active(context.Background(), "word-counts")
+		require.NoError(t, err)
+		assert.Equal(t, 2, active)
+		position, err := r.LoadCheckpoint(context.Background(), "word-counts/active")
+		require.NoError(t, err)
+		assert.Zero(t, position)
+	})
+
+	t.Run("names cannot collide with versions", func(t *testing.T) {
+		r, es := newDaemonEventStore()
+		d := eventstore.NewProjectionDaemon(es, r)
+		require.NoError(t, d.RegisterVersion("word-counts", 2, newWordCounts(), eventstore.AsyncProjectionOptions{}))
+
+		assert.ErrorIs(t, d.Register("word-counts/v2", newWordCounts(), eventstore.AsyncProjectionOptions{}), eventstore.ErrInvalidProjectionName)
+		assert.ErrorIs(t, d.RegisterVersion("word-counts/active", 1, newWordCounts(), eventstore.AsyncProjectionOptions{}), eventstore.ErrInvalidProjectionName)
+	})
+
+	t.Run("nothing to swap to", func(t *testing.T) {
+		r, es := newDaemonEventStore()
+		d := eventstore.NewProjectionDaemon(es, r)
+		require.NoError(t, d.RegisterVersion("word-counts", 1, newWordCounts(), eventstore.AsyncProjectionOptions{}))
+
+		assert.ErrorIs(t, d.Swap(context.Background(), "word-counts"), eventstore.ErrNoShadowProjection)
+		assert.ErrorIs(t, d.Swap(context.Background(), "unknown"), eventstore.ErrProjectionNotFound)
+		assert.ErrorIs(t, d.RegisterVersion("word-counts", 0, newWordCounts(), eventstore.AsyncProjectionOptions{}), eventstore.ErrInvalidProjectionVersion)
+	})
+
+	t.Run("reset rebuilds the read model", func(t *testing.T) {
+		r, es := newDaemonEventStore()
+		publishAll(t, es.GetStream("word-1").Publisher, "a", "b")
+		counts := newWordCounts()
+		d := eventstore.NewProjectionDaemon(es, r)
+		require.NoError(t, d.Register("word-counts", counts, eventstore.AsyncProjectionOptions{}))
+		stop := runDaemon(d)
+		defer stop()
+		assert.Eventually(t, caughtUp(t, d), time.Second, time.Millisecond)
+
+		require.NoError(t, d.Reset(context.Background(), "word-counts"))
+
+		assert.Eventually(t, caughtUp(t, d), time.Second, time.Millisecond)
+		assert.Equal(t, map[string]int{"word-1": 2}, counts.snapshot())
+		assert.Equal(t, 2, counts.batches)
+		assert.ErrorIs(t, d.Reset(context.Background(), "unknown"), eventstore.ErrProjectionNotFound)
+	})
+}
@@ -0,0 +1,74 @@
+package eventstore_test
+
+import (
+	"context"
+	"github.com/nbarbey/go-event-store/eventstore"
+	"github.com/nbarbey/go-event-store/eventstore/codec"
+	"github.com/nbarbey/go-event-store/eventstore/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type parcelEvent interface {
+	isParcelEvent()
+}
+
+type parcelShipped struct{ Carrier string }
+
+func (parcelShipped) isParcelEvent() {}
+
+type parcelDelivered struct{ SignedBy string }
+
+func (parcelDelivered) isParcelEvent() {}
+
+func init() {
+	codec.Register[parcelEvent, parcelShipped]("parcelShipped")
+	codec.Register[parcelEvent, parcelDelivered]("parcelDelivered")
+}
+
+func TestEventStore_registered_types(t *testing.T) {
+	for name, es := range map[string]*eventstore.EventStore[parcelEvent]{
+		"gob":  eventstore.NewInMemoryEventStore[parcelEvent](),
+		"JSON": eventstore.NewEventStoreFromRepository(repository.NewTypedRepository[parcelEvent](repository.NewInMemory(), codec.NewJSONCodecWithTypeHints[parcelEvent](nil))),
+	} {
+		t.Run("publish without type hint with "+name, func(t *testing.T) {
+			s := es.GetStream("parcel-1")
+			require.NoError(t, s.Publish(context.Background(), parcelShipped{Carrier: "La Poste"}))
+			require.NoError(t, s.Publish(context.Background(), parcelDelivered{SignedBy: "Alice"}))
+
+			envelopes, err := s.Listener.ReadEnvelopes(context.Background(), 0, 0)
+			require.NoError(t, err)
+			require.Len(t, envelopes, 2)
+			assert.Equal(t, "parcelShipped", envelopes[0].EventType)
+			assert.Equal(t, parcelShipped{Carrier: "La Poste"}, envelopes[0].Event)
+			assert.Equal(t, "parcelDelivered", envelopes[1].EventType)
+			assert.Equal(t, parcelDelivered{SignedBy: "Alice"}, envelopes[1].Event)
+		})
+	}
+}
+
+func TestEventStore_registered_types_with_upcaster(t *testing.T) {
+	ctx := context.Background()
+	upcaster := codec.NewUpcaster[parcelEvent](codec.NewJSONCodecWithTypeHints[parcelEvent](nil)).
+		UpcastValue("parcelDelivered", 1, func(event parcelEvent) (parcelEvent, error) {
+			delivered := event.(parcelDelivered)
+			delivered.SignedBy = "signed by " + delivered.SignedBy
+			return delivered, nil
+		})
+	r := repository.NewInMemory()
+	s := eventstore.NewEventStoreFromRepository(repository.NewTypedRepository[parcelEvent](r, upcaster)).GetStream("parcel-1")
+	v1, err := codec.NewJSONCodec[parcelDelivered]().Marshall(parcelDelivered{SignedBy: "Alice"})
+	require.NoError(t, err)
+	_, err = r.Stream("parcel-1").InsertRawEvent(ctx, repository.RawEvent{EventType: "parcelDelivered", ContentType: codec.ContentTypeJSON, Payload: v1}, "")
+	require.NoError(t, err)
+
+	require.NoError(t, s.Publish(ctx, parcelDelivered{SignedBy: "signed by Bob"}))
+
+	envelopes, err := s.Listener.ReadEnvelopes(ctx, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, envelopes, 2)
+	assert.Equal(t, parcelDelivered{SignedBy: "signed by Alice"}, envelopes[0].Event)
+	assert.Equal(t, "parcelDelivered/v2", envelopes[1].EventType)
+	assert.Equal(t, parcelDelivered{SignedBy: "signed by Bob"}, envelopes[1].Event)
+}
@@ -23,9 +23,6 @@ func TestEventStore_with_string_type(t *testing.T) {
 		var received string
 		stringEventStore.Subscribe(makeTestConsumer[string](&received))
 
-		// give time for listener to be set-up properly
-		time.Sleep(10 * time.Millisecond)
-
 		err := stringEventStore.Publish(context.Background(), "my_event_data")
 		require.NoError(t, err)
 
@@ -35,13 +32,11 @@ func TestEventStore_with_string_type(t *testing.T) {
 	})
 	t.Run("subscribe is cancellable", func(t *testing.T) {
 		var received string
-		subscription := stringEventStore.Subscribe(makeTestConsumer[string](&received))
+		subscription, err := stringEventStore.Subscribe(makeTestConsumer[string](&received))
+		require.NoError(t, err)
 		defer subscription.Cancel()
 
-		// give time for listener to be set-up properly
-		time.Sleep(10 * time.Millisecond)
-
-		err := stringEventStore.Publish(context.Background(), "my_event_data")
+		err = stringEventStore.Publish(context.Background(), "my_event_data")
 		require.NoError(t, err)
 
 		assert.Eventually(t, func() bool {
@@ -55,9 +50,6 @@ func TestEventStore_with_string_type(t *testing.T) {
 		var received string
 		require.NoError(t, stringEventStore.SubscribeFromBeginning(context.Background(), makeTestConsumer[string](&received)))
 
-		// give time for listener to be set-up properly
-		time.Sleep(10 * time.Millisecond)
-
 		assert.Eventually(t, func() bool {
 			return "my_event_data" == string(received)
 		}, time.Second, 10*time.Millisecond)
@@ -68,9 +60,6 @@ func TestEventStore_with_string_type(t *testing.T) {
 		var receivedOther string
 		stringEventStore.GetStream("other-string-stream").Subscribe(makeTestConsumer[string](&receivedOther))
 
-		// give time for listener to be set-up properly
-		time.Sleep(10 * time.Millisecond)
-
 		err := stringEventStore.GetStream("some-string-stream").Publish(context.Background(), "my_event_data")
 		require.NoError(t, err)
 
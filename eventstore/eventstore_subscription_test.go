@@ -0,0 +1,191 @@
+package eventstore_test
+
+import (
+	"context"
+	"errors"
+	"github.com/nbarbey/go-event-store/eventstore"
+	"github.com/nbarbey/go-event-store/eventstore/codec"
+	"github.com/nbarbey/go-event-store/eventstore/consumer"
+	"github.com/nbarbey/go-event-store/eventstore/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+type recordingConsumer struct {
+	mutex    sync.Mutex
+	received []string
+}
+
+func (r *recordingConsumer) Consume(e string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.received = append(r.received, e)
+}
+
+func (r *recordingConsumer) Received() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string{}, r.received...)
+}
+
+func publishAll(t *testing.T, p *eventstore.Publisher[string], events ...string) {
+	for _, e := range events {
+		require.NoError(t, p.Publish(context.Background(), e))
+	}
+}
+
+func TestEventStore_subscription_control(t *testing.T) {
+	t.Run("subscription starts at the head of the stream", func(t *testing.T) {
+		es := eventstore.NewInMemoryEventStore[string]()
+		publishAll(t, es.Publisher, "before")
+		received := &recordingConsumer{}
+		subscription, err := es.Subscribe(received)
+		require.NoError(t, err)
+		defer subscription.Cancel()
+
+		publishAll(t, es.Publisher, "after")
+
+		assert.Equal(t, []string{"after"}, received.Received())
+	})
+
+	t.Run("pause then resume without losing events", func(t *testing.T) {
+		es := eventstore.NewInMemoryEventStore[string]()
+		received := &recordingConsumer{}
+		subscription, err := es.Subscribe(received)
+		require.NoError(t, err)
+		defer subscription.Cancel()
+
+		publishAll(t, es.Publisher, "one")
+		subscription.Pause()
+		publishAll(t, es.Publisher, "two", "three")
+		assert.Equal(t, []string{"one"}, received.Received())
+
+		require.NoError(t, subscription.Resume())
+		publishAll(t, es.Publisher, "four")
+
+		assert.Equal(t, []string{"one", "two", "three", "four"}, received.Received())
+	})
+
+	t.Run("seek back to an earlier position", func(t *testing.T) {
+		es := eventstore.NewInMemoryEventStore[string]()
+		received := &recordingConsumer{}
+		subscription, err := es.Subscribe(received)
+		require.NoError(t, err)
+		defer subscription.Cancel()
+
+		publishAll(t, es.Publisher, "one", "two", "three")
+		require.NoError(t, subscription.SeekTo(2))
+
+		assert.Equal(t, []string{"one", "two", "three", "two", "three"}, received.Received())
+		assert.Equal(t, int64(3), subscription.Position())
+	})
+
+	t.Run("seek ahead skips events", func(t *testing.T) {
+		es := eventstore.NewInMemoryEventStore[string]()
+		received := &recordingConsumer{}
+		subscription, err := es.Subscribe(received)
+		require.NoError(t, err)
+		defer subscription.Cancel()
+
+		publishAll(t, es.Publisher, "one")
+		require.NoError(t, subscription.SeekTo(3))
+		publishAll(t, es.Publisher, "two", "three")
+
+		assert.Equal(t, []string{"one", "three"}, received.Received())
+	})
+
+	t.Run("seek while paused is applied on resume", func(t *testing.T) {
+		es := eventstore.NewInMemoryEventStore[string]()
+		received := &recordingConsumer{}
+		subscription, err := es.Subscribe(received)
+		require.NoError(t, err)
+		defer subscription.Cancel()
+
+		publishAll(t, es.Publisher, "one", "two")
+		subscription.Pause()
+		require.NoError(t, subscription.SeekTo(1))
+		publishAll(t, es.Publisher, "three")
+		assert.Equal(t, []string{"one", "two"}, received.Received())
+
+		require.NoError(t, subscription.Resume())
+
+		assert.Equal(t, []string{"one", "two", "one", "two", "three"}, received.Received())
+	})
+
+	t.Run("consumer publishing from Consume", func(t *testing.T) {
+		es := eventstore.NewInMemoryEventStore[string]()
+		received := &recordingConsumer{}
+		subscription, err := es.Subscribe(consumer.ConsumerFunc[string](func(e string) {
+			received.Consume(e)
+			if e == "ping" {
+				require.NoError(t, es.Publish(context.Background(), "pong"))
+			}
+		}))
+		require.NoError(t, err)
+		defer subscription.Cancel()
+
+		publishAll(t, es.Publisher, "ping")
+
+		assert.Equal(t, []string{"ping", "pong"}, received.Received())
+	})
+
+	t.Run("subscribing fails when the head cannot be read", func(t *testing.T) {
+		es := eventstore.NewEventStoreFromRepository(repository.NewTypedRepository[string](withoutHead{repository.NewInMemory()}, codec.NewJSONCodecWithTypeHints[string](nil)))
+
+		_, err := es.Subscribe(&recordingConsumer{})
+
+		assert.ErrorIs(t, err, errHeadUnavailable)
+	})
+
+	t.Run("undecodable events are counted and skipped", func(t *testing.T) {
+		r := repository.NewInMemory()
+		es := eventstore.NewEventStoreFromRepository(repository.NewTypedRepository[string](r, codec.NewJSONCodecWithTypeHints[string](nil)))
+		received := &recordingConsumer{}
+		subscription, err := es.Subscribe(received)
+		require.NoError(t, err)
+		defer subscription.Cancel()
+
+		_, err = r.Stream("default-stream").InsertRawEvent(context.Background(), repository.RawEvent{Payload: []byte("not json")}, "")
+		require.NoError(t, err)
+		publishAll(t, es.Publisher, "after")
+
+		assert.Equal(t, []string{"after"}, received.Received())
+		metrics, err := subscription.Metrics(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), metrics.Position)
+		assert.Equal(t, uint64(1), metrics.Errors)
+	})
+
+	t.Run("pause batch subscription", func(t *testing.T) {
+		es := eventstore.NewInMemoryEventStore[string]()
+		batches := make(chan []string, 10)
+		subscription, err := es.SubscribeBatch(consumer.BatchConsumerFunc[string](func(events []string) {
+			batches <- events
+		}), eventstore.BatchOptions{MaxSize: 3})
+		require.NoError(t, err)
+		defer subscription.Cancel()
+
+		subscription.Pause()
+		publishAll(t, es.Publisher, "one", "two", "three")
+		require.NoError(t, subscription.Resume())
+
+		assert.Equal(t, []string{"one", "two", "three"}, <-batches)
+	})
+}
+
+var errHeadUnavailable = errors.New("head unavailable")
+
+// withoutHead fails to read the head position of the repository it wraps.
+type withoutHead struct {
+	repository.Repository
+}
+
+func (r withoutHead) Stream(name string) repository.Repository {
+	return withoutHead{r.Repository.Stream(name)}
+}
+
+func (r withoutHead) HeadPosition(context.Context) (int64, error) {
+	return 0, errHeadUnavailable
+}
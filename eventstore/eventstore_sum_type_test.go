@@ -61,9 +61,6 @@ func TestEventStore_with_sum_type(t *testing.T) {
 			}
 		}))
 
-		// give time for listener to be set-up properly
-		time.Sleep(10 * time.Millisecond)
-
 		christmas := time.Date(2025, 12, 24, 0, 0, 0, 0, time.UTC)
 		created := todoCreated{Date: christmas}
 		err := s.WithType("todoCreated").Publish(context.Background(), created)
@@ -0,0 +1,167 @@
+package eventstore_test
+
+import (
+	"context"
+	"github.com/nbarbey/go-event-store/eventstore"
+	"github.com/nbarbey/go-event-store/eventstore/codec"
+	"github.com/nbarbey/go-event-store/eventstore/consumer"
+	"github.com/nbarbey/go-event-store/eventstore/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newItemAddedOnlyEventStore knows about itemAdded but not about itemRemoved, like an
+// older version of a service reading events written by a newer one.
+func newItemAddedOnlyEventStore(policy codec.UnknownTypePolicy) (*repository.InMemory, *eventstore.EventStore[cartEvent]) {
+	r := repository.NewInMemory()
+	c := codec.NewJSONCodecWithTypeHints[cartEvent](codec.NewUnmarshallerMap[cartEvent]().
+		AddFunc("itemAdded", func(payload []byte) (event cartEvent, err error) {
+			return codec.BuildJSONUnmarshalFunc[itemAdded]()(payload)
+		})).WithUnknownTypePolicy(policy)
+	return r, eventstore.NewEventStoreFromRepository(repository.NewTypedRepository[cartEvent](r, c))
+}
+
+func publishCartEvents(t *testing.T, es *eventstore.EventStore[cartEvent], events ...cartEvent) {
+	for _, e := range events {
+		require.NoError(t, es.GetStream("cart-1").WithType(cartTypeHint(e)).Publish(context.Background(), e))
+	}
+}
+
+func TestEventStore_unknown_event_types(t *testing.T) {
+	t.Run("reject unknown types", func(t *testing.T) {
+		_, es := newItemAddedOnlyEventStore(codec.RejectUnknownTypes)
+		publishCartEvents(t, es, itemAdded{Price: 1}, itemRemoved{Price: 1})
+
+		_, err := es.GetStream("cart-1").Listener.All(context.Background())
+		assert.ErrorIs(t, err, codec.ErrUnknownEventType)
+	})
+
+	t.Run("skip unknown types when reading", func(t *testing.T) {
+		_, es := newItemAddedOnlyEventStore(codec.SkipUnknownTypes)
+		publishCartEvents(t, es, itemAdded{Price: 1}, itemRemoved{Price: 1}, itemAdded{Price: 2})
+
+		events, err := es.GetStream("cart-1").Listener.All(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []cartEvent{itemAdded{Price: 1}, itemAdded{Price: 2}}, events)
+	})
+
+	t.Run("skip unknown types in subscriptions", func(t *testing.T) {
+		_, es := newItemAddedOnlyEventStore(codec.SkipUnknownTypes)
+		var mutex sync.Mutex
+		var received []cartEvent
+		subscription, err := es.GetStream("cart-1").Subscribe(consumer.ConsumerFunc[cartEvent](func(e cartEvent) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			received = append(received, e)
+		}))
+		require.NoError(t, err)
+		defer subscription.Cancel()
+		subscription.Pause()
+		publishCartEvents(t, es, itemAdded{Price: 1}, itemRemoved{Price: 1})
+		require.NoError(t, subscription.Resume())
+
+		publishCartEvents(t, es, itemRemoved{Price: 1}, itemAdded{Price: 2})
+
+		assert.Eventually(t, func() bool {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return len(received) == 2
+		}, time.Second, time.Millisecond)
+		assert.Equal(t, []cartEvent{itemAdded{Price: 1}, itemAdded{Price: 2}}, received)
+		assert.Equal(t, int64(4), subscription.Position())
+	})
+
+	t.Run("projections move past batches of unknown types", func(t *testing.T) {
+		r, es := newItemAddedOnlyEventStore(codec.SkipUnknownTypes)
+		publishCartEvents(t, es, itemRemoved{Price: 1}, itemRemoved{Price: 1}, itemAdded{Price: 2})
+		var mutex sync.Mutex
+		var projected []cartEvent
+		d := eventstore.NewProjectionDaemon(es, r)
+		require.NoError(t, d.Register("carts", eventstore.AsyncProjectionFunc[cartEvent](func(ctx context.Context, _ repository.Tx, envelopes []repository.Envelope[cartEvent]) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			for _, envelope := range envelopes {
+				projected = append(projected, envelope.Event)
+			}
+			return nil
+		}), eventstore.AsyncProjectionOptions{BatchSize: 1}))
+		stop := runDaemon(d)
+		defer stop()
+
+		assert.Eventually(t, func() bool {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return len(projected) == 1
+		}, time.Second, time.Millisecond)
+		assert.Equal(t, []cartEvent{itemAdded{Price: 2}}, projected)
+	})
+
+	t.Run("skip unknown types kept raw when events cannot hold them", func(t *testing.T) {
+		_, es := newItemAddedOnlyEventStore(codec.KeepUnknownTypesRaw)
+		var mutex sync.Mutex
+		var received []cartEvent
+		subscription, err := es.GetStream("cart-1").Subscribe(consumer.ConsumerFunc[cartEvent](func(e cartEvent) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			received = append(received, e)
+		}))
+		require.NoError(t, err)
+		defer subscription.Cancel()
+		publishCartEvents(t, es, itemAdded{Price: 1}, itemRemoved{Price: 1})
+
+		envelopes, err := es.GetStream("cart-1").Listener.ReadEnvelopes(context.Background(), 0, 0)
+		require.NoError(t, err)
+		require.Len(t, envelopes, 1)
+		assert.Nil(t, envelopes[0].Unknown)
+		events, err := es.GetStream("cart-1").Listener.All(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []cartEvent{itemAdded{Price: 1}}, events)
+		assert.Eventually(t, func() bool { return subscription.Position() == 2 }, time.Second, time.Millisecond)
+		mutex.Lock()
+		defer mutex.Unlock()
+		assert.Equal(t, []cartEvent{itemAdded{Price: 1}}, received)
+	})
+
+	t.Run("keep unknown types raw as events when possible", func(t *testing.T) {
+		es := eventstore.NewEventStoreFromRepository(repository.NewTypedRepository[any](repository.NewInMemory(),
+			codec.NewJSONCodecWithTypeHints[any](nil).WithUnknownTypePolicy(codec.KeepUnknownTypesRaw)))
+		require.NoError(t, es.WithType("itemRemoved").Publish(context.Background(), itemRemoved{Price: 1}))
+
+		events, err := es.Listener.All(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []any{codec.UnknownEvent{TypeHint: "itemRemoved", Payload: []byte(`{"Price":1}`)}}, events)
+		envelopes, err := es.Listener.ReadEnvelopes(context.Background(), 0, 0)
+		require.NoError(t, err)
+		require.Len(t, envelopes, 1)
+		assert.Equal(t, &codec.UnknownEvent{TypeHint: "itemRemoved", Payload: []byte(`{"Price":1}`)}, envelopes[0].Unknown)
+	})
+
+	t.Run("save aggregates whose last events are skipped", func(t *testing.T) {
+		_, es := newItemAddedOnlyEventStore(codec.SkipUnknownTypes)
+		publishCartEvents(t, es, itemAdded{Price: 1}, itemRemoved{Price: 1})
+		carts := eventstore.NewAggregateRepository[cart, cartEvent](es, "cart", applyCartEvent).WithTypeHints(cartTypeHint)
+
+		c, err := carts.Load(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), c.Position)
+		c.Raise(itemAdded{Price: 2})
+
+		require.NoError(t, carts.Save(context.Background(), c))
+	})
+
+	t.Run("skipped events are not errors of live events", func(t *testing.T) {
+		_, es := newItemAddedOnlyEventStore(codec.SkipUnknownTypes)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		envelopes, errs := es.GetStream("cart-1").Events(ctx, eventstore.EventsOptions{})
+
+		publishCartEvents(t, es, itemRemoved{Price: 1}, itemAdded{Price: 2})
+
+		envelope := <-envelopes
+		assert.Equal(t, itemAdded{Price: 2}, envelope.Event)
+		assert.Empty(t, errs)
+	})
+}
@@ -29,9 +29,6 @@ func TestEventStore_custom_event_with_version(t *testing.T) {
 		myStream := customEventStore.GetStream("my-custom-event-stream")
 		myStream.Subscribe(makeTestConsumer[item](&received))
 
-		// give time for listener to be set-up properly
-		time.Sleep(10 * time.Millisecond)
-
 		err := myStream.Publish(context.Background(), item{Name: "Pan", Description: "Carbon steel"})
 		require.NoError(t, err)
 
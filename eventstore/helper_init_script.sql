@@ -9,3 +9,6 @@ grant all privileges on schema todo_events to "postgres";
 
 create schema if not exists items_events authorization "postgres";
 grant all privileges on schema items_events to "postgres";
+
+create schema if not exists payments_events authorization "postgres";
+grant all privileges on schema payments_events to "postgres";
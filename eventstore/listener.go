@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/nbarbey/go-event-store/eventstore/consumer"
 	"github.com/nbarbey/go-event-store/eventstore/repository"
+	"time"
 )
 
 type Listener[E any] struct {
@@ -17,22 +18,14 @@ func NewListener[E any](streamId string, r *repository.TypedRepository[E]) *List
 	}
 }
 
-type Subscription struct {
-	cancel func()
-}
-
-func (l *Listener[E]) Subscribe(consumer consumer.Consumer[E]) (subscription *Subscription) {
-	listener := l.BuildListener(consumer)
-
-	subscription = &Subscription{}
-	var ctx context.Context
-	ctx, subscription.cancel = context.WithCancel(context.Background())
-	go func() { _ = listener.Listen(ctx) }()
-	return subscription
-}
-
-func (s Subscription) Cancel() {
-	s.cancel()
+func (l *Listener[E]) Subscribe(consumer consumer.Consumer[E]) (subscription *Subscription, err error) {
+	stats := newSubscriptionStats()
+	return subscribe(l, subscriptionPageSize, stats, false, func(ctx context.Context, envelope repository.Envelope[E]) error {
+		start := time.Now()
+		consumer.Consume(envelope.Event)
+		stats.observe(time.Since(start), 1)
+		return nil
+	}, nil)
 }
 
 func (l *Listener[E]) SubscribeFromBeginning(ctx context.Context, consumer consumer.Consumer[E]) (err error) {
@@ -43,6 +36,6 @@ func (l *Listener[E]) SubscribeFromBeginning(ctx context.Context, consumer consu
 	for _, e := range events {
 		consumer.Consume(e)
 	}
-	l.Subscribe(consumer)
-	return nil
+	_, err = l.Subscribe(consumer)
+	return err
 }
@@ -0,0 +1,87 @@
+package eventstore
+
+import (
+	"context"
+	"github.com/nbarbey/go-event-store/eventstore/consumer"
+	"github.com/nbarbey/go-event-store/eventstore/repository"
+	"time"
+)
+
+type BatchOptions struct {
+	MaxSize    int
+	MaxWait    time.Duration
+	BufferSize int
+}
+
+var DefaultBatchOptions = BatchOptions{MaxSize: 100, MaxWait: 100 * time.Millisecond, BufferSize: 1000}
+
+func (o BatchOptions) withDefaults() BatchOptions {
+	if o.MaxSize <= 0 {
+		o.MaxSize = DefaultBatchOptions.MaxSize
+	}
+	if o.MaxWait <= 0 {
+		o.MaxWait = DefaultBatchOptions.MaxWait
+	}
+	if o.BufferSize <= 0 {
+		o.BufferSize = DefaultBatchOptions.BufferSize
+	}
+	return o
+}
+
+// SubscribeBatch hands events to the consumer by batches of at most MaxSize events, or
+// whatever arrived within MaxWait. At most BufferSize events are held in memory: once
+// the buffer is full, fetching new events pauses until the consumer catches up.
+func (l *Listener[E]) SubscribeBatch(batchConsumer consumer.BatchConsumer[E], options BatchOptions) (subscription *Subscription, err error) {
+	options = options.withDefaults()
+	buffer := make(chan repository.Envelope[E], options.BufferSize)
+
+	stats := newSubscriptionStats()
+	subscription, err = subscribe(l, options.MaxSize, stats, true, func(ctx context.Context, envelope repository.Envelope[E]) error {
+		stats.dispatch(envelope.Position)
+		select {
+		case buffer <- envelope:
+			return nil
+		case <-ctx.Done():
+			stats.consumed(envelope.Position)
+			return ctx.Err()
+		}
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	go consumeBatches(subscription.ctx, buffer, options, stats, batchConsumer)
+	return subscription, nil
+}
+
+func consumeBatches[E any](ctx context.Context, buffer <-chan repository.Envelope[E], options BatchOptions, stats *subscriptionStats, batchConsumer consumer.BatchConsumer[E]) {
+	for {
+		batch := make([]E, 0, options.MaxSize)
+		positions := make([]int64, 0, options.MaxSize)
+		select {
+		case <-ctx.Done():
+			return
+		case envelope := <-buffer:
+			batch, positions = append(batch, envelope.Event), append(positions, envelope.Position)
+		}
+
+		timer := time.NewTimer(options.MaxWait)
+	fill:
+		for len(batch) < options.MaxSize {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case envelope := <-buffer:
+				batch, positions = append(batch, envelope.Event), append(positions, envelope.Position)
+			case <-timer.C:
+				break fill
+			}
+		}
+		timer.Stop()
+
+		start := time.Now()
+		batchConsumer.ConsumeBatch(batch)
+		stats.observe(time.Since(start), len(batch))
+		stats.consumed(positions...)
+	}
+}
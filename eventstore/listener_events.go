@@ -0,0 +1,92 @@
+package eventstore
+
+import (
+	"context"
+	"github.com/nbarbey/go-event-store/eventstore/repository"
+	"iter"
+)
+
+type EventsOptions struct {
+	BufferSize int
+}
+
+var DefaultEventsOptions = EventsOptions{BufferSize: 100}
+
+func (o EventsOptions) withDefaults() EventsOptions {
+	if o.BufferSize <= 0 {
+		o.BufferSize = DefaultEventsOptions.BufferSize
+	}
+	return o
+}
+
+// Events delivers the events published once it returns until ctx is cancelled, after
+// which both channels are closed. Events are fetched in the background, at most BufferSize
+// at a time, as they are received. Errors met while fetching events, including events that
+// cannot be decoded, are sent on the error channel, so both channels have to be drained.
+func (l *Listener[E]) Events(ctx context.Context, options EventsOptions) (<-chan repository.Envelope[E], <-chan error) {
+	options = options.withDefaults()
+	envelopes := make(chan repository.Envelope[E], options.BufferSize)
+	errs := make(chan error, 1)
+
+	subscription, err := subscribe(l, options.BufferSize, newSubscriptionStats(), true, func(_ context.Context, envelope repository.Envelope[E]) error {
+		select {
+		case envelopes <- envelope:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}, func(_ context.Context, err error) error {
+		select {
+		case errs <- err:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	if err != nil {
+		errs <- err
+		close(errs)
+		close(envelopes)
+		return envelopes, errs
+	}
+
+	go func() {
+		<-ctx.Done()
+		subscription.Cancel()
+		// nothing is sent on the channels once the delivery has stopped
+		<-subscription.delivered
+		close(errs)
+		close(envelopes)
+	}()
+	return envelopes, errs
+}
+
+// EventsSeq subscribes when called, so that the events published before iterating are
+// not missed. It is iterated once, and holds the subscription until then, or until ctx
+// is cancelled.
+func (l *Listener[E]) EventsSeq(ctx context.Context, options EventsOptions) iter.Seq2[repository.Envelope[E], error] {
+	ctx, cancel := context.WithCancel(ctx)
+	envelopes, errs := l.Events(ctx, options)
+	return func(yield func(repository.Envelope[E], error) bool) {
+		defer cancel()
+
+		for {
+			select {
+			case envelope, ok := <-envelopes:
+				if !ok {
+					return
+				}
+				if !yield(envelope, nil) {
+					return
+				}
+			case err, ok := <-errs:
+				if !ok {
+					return
+				}
+				if !yield(repository.Envelope[E]{}, err) {
+					return
+				}
+			}
+		}
+	}
+}
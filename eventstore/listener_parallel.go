@@ -0,0 +1,86 @@
+package eventstore
+
+import (
+	"context"
+	"github.com/nbarbey/go-event-store/eventstore/consumer"
+	"github.com/nbarbey/go-event-store/eventstore/repository"
+	"hash/fnv"
+	"runtime"
+	"time"
+)
+
+type ParallelOptions[E any] struct {
+	Workers     int
+	Key         func(envelope repository.Envelope[E]) string
+	MaxInFlight int
+}
+
+func ByStream[E any](envelope repository.Envelope[E]) string {
+	return envelope.StreamID
+}
+
+func (o ParallelOptions[E]) withDefaults() ParallelOptions[E] {
+	if o.Workers <= 0 {
+		o.Workers = runtime.GOMAXPROCS(0)
+	}
+	if o.Key == nil {
+		o.Key = ByStream[E]
+	}
+	if o.MaxInFlight <= 0 {
+		o.MaxInFlight = 100 * o.Workers
+	}
+	return o
+}
+
+// SubscribeParallel dispatches events to several workers. Events sharing the same key,
+// the stream name by default, always go to the same worker so that they are consumed in
+// order, while events of different keys are consumed in parallel. At most MaxInFlight
+// events are dispatched and not yet consumed at any time.
+func (l *Listener[E]) SubscribeParallel(c consumer.Consumer[E], options ParallelOptions[E]) (subscription *Subscription, err error) {
+	options = options.withDefaults()
+	inFlight := make(chan struct{}, options.MaxInFlight)
+	workers := make([]chan repository.Envelope[E], options.Workers)
+	for i := range workers {
+		workers[i] = make(chan repository.Envelope[E], options.MaxInFlight)
+	}
+
+	stats := newSubscriptionStats()
+	subscription, err = subscribe(l, options.MaxInFlight, stats, true, func(ctx context.Context, envelope repository.Envelope[E]) error {
+		select {
+		case inFlight <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		stats.dispatch(envelope.Position)
+		workers[workerIndex(options.Key(envelope), len(workers))] <- envelope
+		return nil
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, worker := range workers {
+		go consumeInOrder(subscription.ctx, worker, inFlight, stats, c)
+	}
+	return subscription, nil
+}
+
+func consumeInOrder[E any](ctx context.Context, envelopes <-chan repository.Envelope[E], inFlight <-chan struct{}, stats *subscriptionStats, c consumer.Consumer[E]) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case envelope := <-envelopes:
+			start := time.Now()
+			c.Consume(envelope.Event)
+			stats.observe(time.Since(start), 1)
+			stats.consumed(envelope.Position)
+			<-inFlight
+		}
+	}
+}
+
+func workerIndex(key string, workers int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(workers))
+}
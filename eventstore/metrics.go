@@ -0,0 +1,160 @@
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var DefaultLatencyBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type Histogram struct {
+	Buckets []float64
+	Counts  []uint64
+	Count   uint64
+	Sum     float64
+}
+
+func newHistogram(buckets []float64) Histogram {
+	return Histogram{Buckets: buckets, Counts: make([]uint64, len(buckets))}
+}
+
+func (h *Histogram) observe(value float64) {
+	for i, bucket := range h.Buckets {
+		if value <= bucket {
+			h.Counts[i]++
+		}
+	}
+	h.Count++
+	h.Sum += value
+}
+
+func (h Histogram) clone() Histogram {
+	h.Counts = append([]uint64{}, h.Counts...)
+	return h
+}
+
+type SubscriptionMetrics struct {
+	Position     int64
+	HeadPosition int64
+	LagEvents    int64
+	LagSeconds   float64
+	Handled      uint64
+	Errors       uint64
+	Latency      Histogram
+}
+
+type subscriptionStats struct {
+	mutex   sync.Mutex
+	handled uint64
+	errors  uint64
+	latency Histogram
+	// inFlight counts the events handed over to consumers of their own by position, until
+	// consumed, for the metrics to report the position of the last event processed.
+	inFlight map[int64]int
+}
+
+func newSubscriptionStats() *subscriptionStats {
+	return &subscriptionStats{latency: newHistogram(DefaultLatencyBuckets)}
+}
+
+func (s *subscriptionStats) failed() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.errors++
+}
+
+// observe records a call to a consumer, handling events in latency.
+func (s *subscriptionStats) observe(latency time.Duration, events int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.handled += uint64(events)
+	s.latency.observe(latency.Seconds())
+}
+
+// dispatch records an event handed over to a consumer, before it may be consumed.
+func (s *subscriptionStats) dispatch(position int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.inFlight == nil {
+		s.inFlight = make(map[int64]int)
+	}
+	s.inFlight[position]++
+}
+
+// consumed records the dispatched events a consumer is done with.
+func (s *subscriptionStats) consumed(positions ...int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, position := range positions {
+		if s.inFlight[position]--; s.inFlight[position] <= 0 {
+			delete(s.inFlight, position)
+		}
+	}
+}
+
+// processed is the position of the last event processed when the subscription has read up
+// to position: the one before the oldest event still in flight, if any.
+func (s *subscriptionStats) processed(position int64) int64 {
+	for inFlight := range s.inFlight {
+		position = min(position, inFlight-1)
+	}
+	return position
+}
+
+// MetricsCollector receives the metrics of every registered subscription, so that they can
+// be exported to any monitoring system.
+type MetricsCollector interface {
+	Collect(subscription string, metrics SubscriptionMetrics)
+}
+
+type MetricsRegistry struct {
+	mutex         sync.Mutex
+	subscriptions map[string]*Subscription
+}
+
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{subscriptions: make(map[string]*Subscription)}
+}
+
+func (r *MetricsRegistry) Register(name string, subscription *Subscription) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.subscriptions[name] = subscription
+}
+
+func (r *MetricsRegistry) Unregister(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.subscriptions, name)
+}
+
+// CollectTo hands the metrics of every subscription to collector. Subscriptions whose
+// metrics cannot be read are skipped, and their errors returned once the others are collected.
+func (r *MetricsRegistry) CollectTo(ctx context.Context, collector MetricsCollector) error {
+	r.mutex.Lock()
+	names := make([]string, 0, len(r.subscriptions))
+	for name := range r.subscriptions {
+		names = append(names, name)
+	}
+	subscriptions := make(map[string]*Subscription, len(r.subscriptions))
+	for name, subscription := range r.subscriptions {
+		subscriptions[name] = subscription
+	}
+	r.mutex.Unlock()
+
+	sort.Strings(names)
+	var errs []error
+	for _, name := range names {
+		metrics, err := subscriptions[name].Metrics(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("subscription %q: %w", name, err))
+			continue
+		}
+		collector.Collect(name, metrics)
+	}
+	return errors.Join(errs...)
+}
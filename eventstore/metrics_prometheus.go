@@ -0,0 +1,95 @@
+package eventstore
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// PrometheusExporter serves the metrics of a MetricsRegistry in the Prometheus text format.
+type PrometheusExporter struct {
+	registry *MetricsRegistry
+}
+
+func NewPrometheusExporter(registry *MetricsRegistry) *PrometheusExporter {
+	return &PrometheusExporter{registry: registry}
+}
+
+func (e *PrometheusExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	collector := newPrometheusCollector()
+	// a subscription whose metrics cannot be read is left out rather than failing the scrape
+	err := e.registry.CollectTo(r.Context(), collector)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = collector.WriteTo(w)
+	if err != nil {
+		_, _ = fmt.Fprintf(w, "# %s\n", strings.ReplaceAll(err.Error(), "\n", "\n# "))
+	}
+}
+
+type prometheusMetric struct {
+	help, kind string
+	samples    bytes.Buffer
+}
+
+type prometheusCollector struct {
+	names   []string
+	metrics map[string]*prometheusMetric
+}
+
+func newPrometheusCollector() *prometheusCollector {
+	c := &prometheusCollector{metrics: make(map[string]*prometheusMetric)}
+	c.declare("eventstore_subscription_position", "gauge", "Position of the last event processed by the subscription.")
+	c.declare("eventstore_subscription_head_position", "gauge", "Position of the last event of the subscribed stream.")
+	c.declare("eventstore_subscription_lag_events", "gauge", "Number of events not yet processed by the subscription.")
+	c.declare("eventstore_subscription_lag_seconds", "gauge", "Age of the oldest event not yet processed by the subscription.")
+	c.declare("eventstore_subscription_events_total", "counter", "Number of events handled by the subscription.")
+	c.declare("eventstore_subscription_errors_total", "counter", "Number of events the subscription failed to handle.")
+	c.declare("eventstore_subscription_handler_seconds", "histogram", "Time spent handling an event.")
+	return c
+}
+
+func (c *prometheusCollector) declare(name, kind, help string) {
+	c.names = append(c.names, name)
+	c.metrics[name] = &prometheusMetric{help: help, kind: kind}
+}
+
+func (c *prometheusCollector) sample(name, suffix, labels string, value float64) {
+	_, _ = fmt.Fprintf(&c.metrics[name].samples, "%s%s{%s} %s\n", name, suffix, labels, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+func (c *prometheusCollector) Collect(subscription string, m SubscriptionMetrics) {
+	labels := fmt.Sprintf(`subscription="%s"`, escapeLabelValue(subscription))
+	c.sample("eventstore_subscription_position", "", labels, float64(m.Position))
+	c.sample("eventstore_subscription_head_position", "", labels, float64(m.HeadPosition))
+	c.sample("eventstore_subscription_lag_events", "", labels, float64(m.LagEvents))
+	c.sample("eventstore_subscription_lag_seconds", "", labels, m.LagSeconds)
+	c.sample("eventstore_subscription_events_total", "", labels, float64(m.Handled))
+	c.sample("eventstore_subscription_errors_total", "", labels, float64(m.Errors))
+
+	name := "eventstore_subscription_handler_seconds"
+	for i, bucket := range m.Latency.Buckets {
+		le := strconv.FormatFloat(bucket, 'g', -1, 64)
+		c.sample(name, "_bucket", labels+`,le="`+le+`"`, float64(m.Latency.Counts[i]))
+	}
+	c.sample(name, "_bucket", labels+`,le="+Inf"`, float64(m.Latency.Count))
+	c.sample(name, "_sum", labels, m.Latency.Sum)
+	c.sample(name, "_count", labels, float64(m.Latency.Count))
+}
+
+func (c *prometheusCollector) WriteTo(w io.Writer) (int64, error) {
+	var out bytes.Buffer
+	for _, name := range c.names {
+		metric := c.metrics[name]
+		_, _ = fmt.Fprintf(&out, "# HELP %s %s\n# TYPE %s %s\n", name, metric.help, name, metric.kind)
+		out.Write(metric.samples.Bytes())
+	}
+	n, err := w.Write(out.Bytes())
+	return int64(n), err
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,123 @@
+package eventstore
+
+import (
+	"context"
+	"github.com/nbarbey/go-event-store/eventstore/codec"
+	"github.com/nbarbey/go-event-store/eventstore/repository"
+	"strconv"
+)
+
+// Saga holds the logic of a long-running workflow: it tells which instance an event
+// belongs to, and how that instance reacts to it.
+type Saga[S any, E any, C any] interface {
+	Correlate(envelope repository.Envelope[E]) (key string, ok bool)
+	Handle(state S, envelope repository.Envelope[E]) (S, []C, error)
+}
+
+type Dispatcher[C any] interface {
+	Dispatch(ctx context.Context, command C) error
+}
+
+type DispatcherFunc[C any] func(ctx context.Context, command C) error
+
+func (f DispatcherFunc[C]) Dispatch(ctx context.Context, command C) error {
+	return f(ctx, command)
+}
+
+// ProcessManager runs a saga as an AsyncProjection: registered on a ProjectionDaemon, it
+// resumes from its checkpoint after a restart. The state of each instance is appended to
+// its own stream, a system stream named after the process manager and the correlation key,
+// as S rather than E: readers of AllStreams do not see it.
+//
+// Commands are dispatched before the state is appended, so they are delivered at least
+// once, while the state of an instance never applies the same event twice.
+type ProcessManager[S any, E any, C any] struct {
+	name       string
+	saga       Saga[S, E, C]
+	states     codec.Codec[S]
+	dispatcher Dispatcher[C]
+	repository repository.Repository
+}
+
+func NewProcessManager[S any, E any, C any](es *EventStore[E], name string, saga Saga[S, E, C], states codec.Codec[S], dispatcher Dispatcher[C]) *ProcessManager[S, E, C] {
+	return &ProcessManager[S, E, C]{
+		name:       name,
+		saga:       saga,
+		states:     states,
+		dispatcher: dispatcher,
+		repository: es.Listener.Repository,
+	}
+}
+
+func (pm *ProcessManager[S, E, C]) Name() string {
+	return pm.name
+}
+
+func (pm *ProcessManager[S, E, C]) StreamName(key string) string {
+	return "$process-" + pm.name + "-" + key
+}
+
+func (pm *ProcessManager[S, E, C]) State(ctx context.Context, key string) (state S, err error) {
+	state, _, err = pm.load(ctx, key)
+	return
+}
+
+// Apply appends states outside of tx: an event whose state was appended is not handled
+// again when the batch is retried.
+func (pm *ProcessManager[S, E, C]) Apply(ctx context.Context, _ repository.Tx, envelopes []repository.Envelope[E]) error {
+	for _, envelope := range envelopes {
+		key, ok := pm.saga.Correlate(envelope)
+		if !ok {
+			continue
+		}
+		if err := pm.handle(ctx, key, envelope); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pm *ProcessManager[S, E, C]) handle(ctx context.Context, key string, envelope repository.Envelope[E]) error {
+	state, version, err := pm.load(ctx, key)
+	if err != nil {
+		return err
+	}
+	// the version of a state is the position of the event that led to it
+	if handled, _ := strconv.ParseInt(version, 10, 64); handled >= envelope.Position {
+		return nil
+	}
+
+	state, commands, err := pm.saga.Handle(state, envelope)
+	if err != nil {
+		return err
+	}
+	for _, command := range commands {
+		if err := pm.dispatcher.Dispatch(ctx, command); err != nil {
+			return err
+		}
+	}
+	payload, err := pm.states.Marshall(state)
+	if err != nil {
+		return err
+	}
+	if version == "" {
+		version = repository.NoStream
+	}
+	_, err = pm.repository.Stream(pm.StreamName(key)).InsertRawEvent(ctx,
+		repository.RawEvent{EventType: pm.name, Version: strconv.FormatInt(envelope.Position, 10), Payload: payload}, version)
+	return err
+}
+
+func (pm *ProcessManager[S, E, C]) load(ctx context.Context, key string) (state S, version string, err error) {
+	stream := pm.repository.Stream(pm.StreamName(key))
+	head, err := stream.HeadPosition(ctx)
+	if err != nil || head == 0 {
+		return
+	}
+	raws, err := stream.ReadRawEvents(ctx, head, 1)
+	if err != nil || len(raws) == 0 {
+		return
+	}
+	state, err = pm.states.Unmarshall(raws[0].Payload)
+	return state, raws[0].Version, err
+}
@@ -0,0 +1,372 @@
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"github.com/nbarbey/go-event-store/eventstore/repository"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AsyncProjection builds a read model in the background. Each batch is applied in the same
+// transaction as the checkpoint of the projection; tx is nil when the store is in memory.
+type AsyncProjection[E any] interface {
+	Apply(ctx context.Context, tx repository.Tx, envelopes []repository.Envelope[E]) error
+}
+
+type AsyncProjectionFunc[E any] func(ctx context.Context, tx repository.Tx, envelopes []repository.Envelope[E]) error
+
+func (f AsyncProjectionFunc[E]) Apply(ctx context.Context, tx repository.Tx, envelopes []repository.Envelope[E]) error {
+	return f(ctx, tx, envelopes)
+}
+
+type AsyncProjectionOptions struct {
+	Stream       string
+	BatchSize    int
+	PollInterval time.Duration
+	// RetryBackoff is the wait after a failure, doubled with each failure in a row up to
+	// MaxRetryBackoff.
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+	// MaxAttempts is how many times an event failing its batch is applied alone, or fails to
+	// be decoded, before it is dead-lettered and skipped.
+	MaxAttempts int
+}
+
+var DefaultAsyncProjectionOptions = AsyncProjectionOptions{
+	Stream:          repository.AllStreams,
+	BatchSize:       100,
+	PollInterval:    time.Second,
+	RetryBackoff:    100 * time.Millisecond,
+	MaxRetryBackoff: 30 * time.Second,
+	MaxAttempts:     5,
+}
+
+func (o AsyncProjectionOptions) withDefaults() AsyncProjectionOptions {
+	if o.Stream == "" {
+		o.Stream = DefaultAsyncProjectionOptions.Stream
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = DefaultAsyncProjectionOptions.BatchSize
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = DefaultAsyncProjectionOptions.PollInterval
+	}
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = DefaultAsyncProjectionOptions.RetryBackoff
+	}
+	if o.MaxRetryBackoff <= 0 {
+		o.MaxRetryBackoff = DefaultAsyncProjectionOptions.MaxRetryBackoff
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = DefaultAsyncProjectionOptions.MaxAttempts
+	}
+	return o
+}
+
+func (o AsyncProjectionOptions) backoff(failures int) time.Duration {
+	backoff := o.RetryBackoff << min(failures-1, 30)
+	if backoff <= 0 || backoff > o.MaxRetryBackoff {
+		return o.MaxRetryBackoff
+	}
+	return backoff
+}
+
+type ProjectionStatus struct {
+	Name         string
+	Version      int
+	Active       bool
+	Stream       string
+	Position     int64
+	HeadPosition int64
+	Running      bool
+	LastError    error
+	UpdatedAt    time.Time
+}
+
+var ErrProjectionAlreadyRegistered = errors.New("projection already registered")
+var ErrProjectionNotFound = errors.New("projection not found")
+
+type ProjectionDaemon[E any] struct {
+	repository  *repository.TypedRepository[E]
+	checkpoints repository.CheckpointStore
+
+	mutex       sync.Mutex
+	projections map[string]*asyncProjection[E]
+	ctx         context.Context
+	running     sync.WaitGroup
+}
+
+func NewProjectionDaemon[E any](es *EventStore[E], checkpoints repository.CheckpointStore) *ProjectionDaemon[E] {
+	return &ProjectionDaemon[E]{
+		repository:  es.Listener.TypedRepository,
+		checkpoints: checkpoints,
+		projections: make(map[string]*asyncProjection[E]),
+	}
+}
+
+// Register adds a projection reading options.Stream from its checkpoint. A projection
+// registered while the daemon runs is started right away.
+func (d *ProjectionDaemon[E]) Register(name string, projection AsyncProjection[E], options AsyncProjectionOptions) error {
+	return d.register(name, 0, projection, options)
+}
+
+func (d *ProjectionDaemon[E]) register(name string, version int, projection AsyncProjection[E], options AsyncProjectionOptions) error {
+	// versions are checkpointed under name/vN, which another projection must not be named
+	if strings.Contains(name, "/") {
+		return ErrInvalidProjectionName
+	}
+	options = options.withDefaults()
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	key := projectionKey(name, version)
+	if _, ok := d.projections[key]; ok {
+		return ErrProjectionAlreadyRegistered
+	}
+	p := &asyncProjection[E]{
+		key:         key,
+		name:        name,
+		version:     version,
+		projection:  projection,
+		options:     options,
+		stream:      d.repository.Stream(options.Stream),
+		checkpoints: d.checkpoints,
+		wakeup:      make(chan struct{}, 1),
+	}
+	d.projections[key] = p
+	if d.ctx != nil {
+		d.start(p)
+	}
+	return nil
+}
+
+// Run processes events for every projection until ctx is done. Batches being applied when
+// ctx is cancelled are completed and checkpointed before Run returns.
+func (d *ProjectionDaemon[E]) Run(ctx context.Context) error {
+	d.mutex.Lock()
+	d.ctx = ctx
+	for _, p := range d.projections {
+		d.start(p)
+	}
+	d.mutex.Unlock()
+
+	<-ctx.Done()
+
+	d.mutex.Lock()
+	d.ctx = nil
+	d.mutex.Unlock()
+	d.running.Wait()
+	return nil
+}
+
+func (d *ProjectionDaemon[E]) start(p *asyncProjection[E]) {
+	ctx, cancel := context.WithCancel(d.ctx)
+	done := make(chan struct{})
+	p.stop = func() {
+		cancel()
+		<-done
+	}
+	d.running.Add(1)
+	go func() {
+		defer d.running.Done()
+		defer close(done)
+		p.run(ctx)
+	}()
+}
+
+// DeadLetters lists the events the projection, or its active version, skipped after
+// failing to apply them.
+func (d *ProjectionDaemon[E]) DeadLetters(ctx context.Context, name string) ([]repository.DeadLetter, error) {
+	p, err := d.lookup(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return d.checkpoints.DeadLetters(ctx, p.key)
+}
+
+func (d *ProjectionDaemon[E]) Status(ctx context.Context) ([]ProjectionStatus, error) {
+	d.mutex.Lock()
+	projections := make([]*asyncProjection[E], 0, len(d.projections))
+	for _, p := range d.projections {
+		projections = append(projections, p)
+	}
+	d.mutex.Unlock()
+	sort.Slice(projections, func(i, j int) bool { return projections[i].key < projections[j].key })
+
+	statuses := make([]ProjectionStatus, 0, len(projections))
+	for _, p := range projections {
+		status, err := p.status(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if p.version == 0 {
+			status.Active = true
+		} else {
+			active, err := d.Active(ctx, p.name)
+			if err != nil {
+				return nil, err
+			}
+			status.Active = active == p.version
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+type asyncProjection[E any] struct {
+	key         string
+	name        string
+	version     int
+	projection  AsyncProjection[E]
+	options     AsyncProjectionOptions
+	stream      *repository.TypedRepository[E]
+	checkpoints repository.CheckpointStore
+	wakeup      chan struct{}
+	stop        func()
+
+	mutex     sync.Mutex
+	running   bool
+	lastError error
+	updatedAt time.Time
+}
+
+func (p *asyncProjection[E]) run(ctx context.Context) {
+	p.setRunning(true)
+	defer p.setRunning(false)
+
+	listener := p.stream.NewListener()
+	listener.Handle(func(context.Context, string) error {
+		select {
+		case p.wakeup <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+	// polling catches up when the listener fails
+	_ = listen(ctx, listener)
+
+	var r retry
+	for ctx.Err() == nil {
+		applied, err := p.step(ctx, &r)
+		if err != nil && ctx.Err() != nil {
+			return
+		}
+		p.report(applied, err)
+		if applied {
+			r.failures = 0
+			continue
+		}
+		wakeup, wait := p.wakeup, p.options.PollInterval
+		if err != nil {
+			r.failures++
+			wakeup, wait = nil, p.options.backoff(r.failures)
+		} else {
+			r.failures = 0
+		}
+		select {
+		case <-ctx.Done():
+		case <-wakeup:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// retry tracks the failures of a running projection. The events of a batch that failed are
+// applied one at a time, up to the end of that batch, so that a poison event is found and
+// dead-lettered alone.
+type retry struct {
+	failures int
+	upTo     int64
+	attempts int
+}
+
+func (p *asyncProjection[E]) step(ctx context.Context, r *retry) (applied bool, err error) {
+	position, err := p.checkpoints.LoadCheckpoint(ctx, p.key)
+	if err != nil {
+		return false, err
+	}
+	batchSize := p.options.BatchSize
+	if position < r.upTo {
+		batchSize = 1
+	}
+	envelopes, lastPosition, err := p.stream.ReadEnvelopePage(ctx, position+1, batchSize)
+	var decodeErr *repository.DecodeError
+	if errors.As(err, &decodeErr) {
+		if lastPosition == position {
+			return p.fail(context.WithoutCancel(ctx), r, decodeErr.Position, decodeErr.EventID, err)
+		}
+		// the events before the one that cannot be decoded are applied first
+		err = nil
+	}
+	if err != nil || lastPosition == position {
+		return false, err
+	}
+	// a batch that has been read is applied even if the daemon is stopping
+	ctx = context.WithoutCancel(ctx)
+	var applyErr error
+	err = p.checkpoints.SaveCheckpoint(ctx, p.key, lastPosition, func(tx repository.Tx) error {
+		if len(envelopes) == 0 {
+			return nil
+		}
+		applyErr = p.projection.Apply(ctx, tx, envelopes)
+		return applyErr
+	})
+	switch {
+	case applyErr == nil:
+		r.attempts = 0
+	case len(envelopes) > 1:
+		r.upTo = lastPosition
+	default:
+		return p.fail(ctx, r, envelopes[0].Position, envelopes[0].EventID, applyErr)
+	}
+	return err == nil, err
+}
+
+// fail counts a failure of the event at position alone, decoding or applying it, and
+// dead-letters it after MaxAttempts.
+func (p *asyncProjection[E]) fail(ctx context.Context, r *retry, position int64, eventID string, cause error) (applied bool, err error) {
+	r.attempts++
+	if r.attempts < p.options.MaxAttempts {
+		return false, cause
+	}
+	r.attempts = 0
+	err = p.deadLetter(ctx, position, eventID, cause)
+	return err == nil, err
+}
+
+// deadLetter records the event at position and moves the checkpoint past it.
+func (p *asyncProjection[E]) deadLetter(ctx context.Context, position int64, eventID string, cause error) error {
+	return p.checkpoints.SaveCheckpoint(ctx, p.key, position, func(tx repository.Tx) error {
+		return p.checkpoints.SaveDeadLetter(ctx, tx, repository.DeadLetter{Name: p.key, Position: position, EventID: eventID, Error: cause.Error()})
+	})
+}
+
+func (p *asyncProjection[E]) setRunning(running bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.running = running
+}
+
+func (p *asyncProjection[E]) report(applied bool, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.lastError = err
+	if applied {
+		p.updatedAt = time.Now()
+	}
+}
+
+func (p *asyncProjection[E]) status(ctx context.Context) (status ProjectionStatus, err error) {
+	p.mutex.Lock()
+	status = ProjectionStatus{Name: p.name, Version: p.version, Stream: p.options.Stream, Running: p.running, LastError: p.lastError, UpdatedAt: p.updatedAt}
+	p.mutex.Unlock()
+
+	status.Position, err = p.checkpoints.LoadCheckpoint(ctx, p.key)
+	if err != nil {
+		return
+	}
+	status.HeadPosition, err = p.stream.HeadPosition(ctx)
+	return
+}
@@ -0,0 +1,25 @@
+package eventstore
+
+import (
+	"context"
+	"github.com/nbarbey/go-event-store/eventstore/repository"
+)
+
+// InlineProjection keeps a read model in the same transaction as the events appended to
+// any stream of the store. tx is nil when the store is in memory, where projections may
+// read the store but not append to it.
+type InlineProjection[E any] interface {
+	Project(ctx context.Context, tx repository.Tx, envelope repository.Envelope[E]) error
+}
+
+type InlineProjectionFunc[E any] func(ctx context.Context, tx repository.Tx, envelope repository.Envelope[E]) error
+
+func (f InlineProjectionFunc[E]) Project(ctx context.Context, tx repository.Tx, envelope repository.Envelope[E]) error {
+	return f(ctx, tx, envelope)
+}
+
+// AddInlineProjection fails with repository.ErrInlineProjectionsNotSupported unless the
+// repository of the store is a repository.InlineProjector.
+func (e *EventStore[E]) AddInlineProjection(projection InlineProjection[E]) (remove func(), err error) {
+	return e.Listener.TypedRepository.AddInlineProjection(projection.Project)
+}
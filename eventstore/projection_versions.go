@@ -0,0 +1,154 @@
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"github.com/nbarbey/go-event-store/eventstore/repository"
+	"strconv"
+)
+
+var ErrInvalidProjectionVersion = errors.New("projection versions start at 1")
+var ErrNoShadowProjection = errors.New("no shadow projection to swap to")
+var ErrProjectionNotCaughtUp = errors.New("projection has not caught up yet")
+var ErrInvalidProjectionName = errors.New("projection names cannot contain '/'")
+
+// ResettableProjection clears its read model when the projection is reset, in the same
+// transaction as its checkpoint.
+type ResettableProjection interface {
+	Reset(ctx context.Context, tx repository.Tx) error
+}
+
+func projectionKey(name string, version int) string {
+	if version == 0 {
+		return name
+	}
+	return name + "/v" + strconv.Itoa(version)
+}
+
+// RegisterVersion adds a version of a projection, with a checkpoint and a read model of its
+// own. The first version registered is active; any other version is a shadow that builds
+// its read model from the first event while the active one keeps serving, until Swap.
+func (d *ProjectionDaemon[E]) RegisterVersion(name string, version int, projection AsyncProjection[E], options AsyncProjectionOptions) error {
+	if version < 1 {
+		return ErrInvalidProjectionVersion
+	}
+	return d.register(name, version, projection, options)
+}
+
+// Active returns the version of the projection whose read model should be queried.
+func (d *ProjectionDaemon[E]) Active(ctx context.Context, name string) (int, error) {
+	active, err := d.checkpoints.LoadActiveVersion(ctx, name)
+	if err != nil || active != 0 {
+		return active, err
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	version := 0
+	for _, p := range d.projections {
+		if p.name == name && p.version > 0 && (version == 0 || p.version < version) {
+			version = p.version
+		}
+	}
+	if version == 0 {
+		return 0, ErrProjectionNotFound
+	}
+	return version, nil
+}
+
+// Swap makes the latest shadow version active once it has caught up with its stream, then
+// stops the previously active version. Its read model is left for the caller to drop.
+func (d *ProjectionDaemon[E]) Swap(ctx context.Context, name string) error {
+	active, err := d.Active(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	var shadow *asyncProjection[E]
+	for _, p := range d.projections {
+		if p.name == name && p.version != active && (shadow == nil || p.version > shadow.version) {
+			shadow = p
+		}
+	}
+	d.mutex.Unlock()
+	if shadow == nil {
+		return ErrNoShadowProjection
+	}
+
+	status, err := shadow.status(ctx)
+	if err != nil {
+		return err
+	}
+	if status.Position < status.HeadPosition {
+		return ErrProjectionNotCaughtUp
+	}
+	err = d.checkpoints.SaveActiveVersion(ctx, name, shadow.version)
+	if err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	var stop func()
+	if previous, ok := d.projections[projectionKey(name, active)]; ok {
+		stop = previous.stop
+		delete(d.projections, previous.key)
+	}
+	d.mutex.Unlock()
+	if stop != nil {
+		stop()
+	}
+	return nil
+}
+
+// Reset stops the projection, or its active version, moves its checkpoint back to the
+// first event and lets it rebuild its read model from scratch.
+func (d *ProjectionDaemon[E]) Reset(ctx context.Context, name string) error {
+	p, err := d.lookup(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	stop := p.stop
+	p.stop = nil
+	d.mutex.Unlock()
+	if stop != nil {
+		stop()
+	}
+
+	err = d.checkpoints.SaveCheckpoint(ctx, p.key, 0, func(tx repository.Tx) error {
+		if resettable, ok := p.projection.(ResettableProjection); ok {
+			return resettable.Reset(ctx, tx)
+		}
+		return nil
+	})
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.ctx != nil && d.projections[p.key] == p {
+		d.start(p)
+	}
+	return err
+}
+
+func (d *ProjectionDaemon[E]) lookup(ctx context.Context, name string) (*asyncProjection[E], error) {
+	d.mutex.Lock()
+	p, ok := d.projections[name]
+	d.mutex.Unlock()
+	if ok {
+		return p, nil
+	}
+
+	active, err := d.Active(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	p, ok = d.projections[projectionKey(name, active)]
+	if !ok {
+		return nil, ErrProjectionNotFound
+	}
+	return p, nil
+}
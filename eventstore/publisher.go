@@ -35,6 +35,12 @@ func (p *Publisher[E]) ExpectedVersion(version string) *Publisher[E] {
 }
 
 func (p *Publisher[E]) Publish(ctx context.Context, event E) (err error) {
-	err = p.InsertEvent(ctx, guid.New().String(), p.typeHint, event, p.expectedVersion)
+	_, err = p.publish(ctx, event)
+	return
+}
+
+func (p *Publisher[E]) publish(ctx context.Context, event E) (version string, err error) {
+	version = guid.New().String()
+	err = p.InsertEvent(ctx, version, p.typeHint, event, p.expectedVersion)
 	return
 }
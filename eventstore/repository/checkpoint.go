@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+// CheckpointStore keeps the position up to which a projection has processed events.
+// SaveCheckpoint runs apply and stores the new position atomically: tx is nil for the
+// in-memory repository, where apply runs before the checkpoint is stored.
+//
+// It also keeps, apart from the checkpoints, which version of a projection is active:
+// LoadActiveVersion returns 0 until SaveActiveVersion is called.
+//
+// SaveDeadLetter records an event a projection skipped, in tx when not nil.
+type CheckpointStore interface {
+	LoadCheckpoint(ctx context.Context, name string) (int64, error)
+	SaveCheckpoint(ctx context.Context, name string, position int64, apply func(tx Tx) error) error
+	LoadActiveVersion(ctx context.Context, name string) (int, error)
+	SaveActiveVersion(ctx context.Context, name string, version int) error
+	SaveDeadLetter(ctx context.Context, tx Tx, letter DeadLetter) error
+	DeadLetters(ctx context.Context, name string) ([]DeadLetter, error)
+}
+
+// DeadLetter is an event that the projection checkpointed as Name kept failing to apply.
+type DeadLetter struct {
+	Name      string
+	Position  int64
+	EventID   string
+	Error     string
+	CreatedAt time.Time
+}
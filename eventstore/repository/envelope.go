@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"github.com/nbarbey/go-event-store/eventstore/codec"
+	"time"
+)
+
+type Envelope[E any] struct {
+	EventID   string
+	StreamID  string
+	Position  int64
+	EventType string
+	Version   string
+	CreatedAt time.Time
+	Event     E
+	// Unknown is set when the codec keeps events of unknown type raw, Event then being the
+	// same codec.UnknownEvent. Such events are skipped when E cannot hold one.
+	Unknown *codec.UnknownEvent
+}
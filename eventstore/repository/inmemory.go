@@ -2,111 +2,301 @@ package repository
 
 import (
 	"context"
+	"slices"
 	"strconv"
+	"sync"
+	"time"
 )
 
 type internalEvent struct {
-	eventId   string
-	eventType *string
-	version   *string
-	streamId  *string
-	payload   []byte
+	eventId     string
+	position    int64
+	eventType   *string
+	version     *string
+	contentType string
+	streamId    *string
+	payload     []byte
+	createdAt   time.Time
 }
 
 func (ie internalEvent) toRawEvent() (raw *RawEvent) {
-	raw = &RawEvent{}
+	raw = &RawEvent{EventID: ie.eventId, Position: ie.position, CreatedAt: ie.createdAt}
+	if ie.streamId != nil {
+		raw.StreamID = *ie.streamId
+	}
 	if ie.eventType != nil {
 		raw.EventType = *ie.eventType
 	}
 	if ie.version != nil {
 		raw.Version = *ie.version
 	}
+	raw.ContentType = ie.contentType
 	raw.Payload = ie.payload
 	return
 }
 
-type InMemory struct {
-	events   map[string][]internalEvent
-	streamId string
-	handler  handler
-}
+type inMemoryStore struct {
+	appendMutex sync.Mutex
+	mutex       sync.RWMutex
+	log         []internalEvent
+	events      map[string][]internalEvent
+	listeners   map[string]map[*InMemoryListener]struct{}
+	snapshots   map[string]RawSnapshot
 
-func (i *InMemory) Handle(h handler) {
-	i.handler = h
+	projections inlineProjections
+	checkpoints map[string]int64
+	versions    map[string]int
+	deadLetters map[string][]DeadLetter
 }
 
-func (i *InMemory) Listen(_ context.Context) error {
-	return nil
-}
-
-func (i *InMemory) NewListener() Listener {
-	return i
+type InMemory struct {
+	*inMemoryStore
+	streamId      string
+	asyncDelivery bool
 }
 
 func NewInMemory() *InMemory {
 	return &InMemory{
-		events:   make(map[string][]internalEvent),
+		inMemoryStore: &inMemoryStore{
+			events:      make(map[string][]internalEvent),
+			listeners:   make(map[string]map[*InMemoryListener]struct{}),
+			snapshots:   make(map[string]RawSnapshot),
+			checkpoints: make(map[string]int64),
+			versions:    make(map[string]int),
+			deadLetters: make(map[string][]DeadLetter),
+		},
 		streamId: "default-stream",
 	}
 }
 
+func (i *InMemory) WithAsyncDelivery() *InMemory {
+	return &InMemory{inMemoryStore: i.inMemoryStore, streamId: i.streamId, asyncDelivery: true}
+}
+
+func (i *InMemory) NewListener() Listener {
+	return &InMemoryListener{streamId: i.streamId, store: i.inMemoryStore, async: i.asyncDelivery, pending: newPendingEvents(i.ReadRawEvents)}
+}
+
 func (i *InMemory) Stream(name string) Repository {
-	i.streamId = name
-	return i
+	return &InMemory{inMemoryStore: i.inMemoryStore, streamId: name, asyncDelivery: i.asyncDelivery}
+}
+
+func (i *InMemory) AddInlineProjection(projection InlineProjection) (remove func()) {
+	return i.projections.add(projection)
 }
 
 func (i *InMemory) GetRawEvent(_ context.Context, eventId string) (*RawEvent, error) {
-	pos, _ := strconv.Atoi(eventId)
-	stream := i.currentStream()
-	eventPos, _ := strconv.Atoi(eventId)
-	if eventPos >= len(stream) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	position, err := strconv.Atoi(eventId)
+	if err != nil || position < 1 || position > len(i.log) {
+		return nil, ErrEventNotFound
+	}
+	event := i.log[position-1]
+	if !streamMatches(i.streamId, *event.streamId) {
 		return nil, ErrEventNotFound
 	}
-	event := stream[pos]
 	return event.toRawEvent(), nil
 }
 
-func (i *InMemory) InsertRawEvent(_ context.Context, raw RawEvent, expectedVersion string) (string, error) {
-	previousEventPosition := len(i.currentStream()) - 1
-	eventId := strconv.Itoa(previousEventPosition + 1)
+func (i *InMemory) InsertRawEvent(ctx context.Context, raw RawEvent, expectedVersion string) (string, error) {
+	inserted, err := i.InsertRawEvents(ctx, []RawEvent{raw}, expectedVersion)
+	if err != nil {
+		return "", err
+	}
+	return inserted[0].EventID, nil
+}
 
-	if expectedVersion != "" {
-		if previousEventPosition >= 0 {
-			lastEvent := i.currentStream()[previousEventPosition]
-			if lastEvent.version != nil && *lastEvent.version != expectedVersion {
-				return "", ErrVersionMismatch
-			}
+func (i *InMemory) InsertRawEvents(ctx context.Context, raws []RawEvent, expectedVersion string) ([]*RawEvent, error) {
+	if isVirtualStream(i.streamId) {
+		return nil, ErrVirtualStream
+	}
+
+	// appends are serialized apart from the store lock, for inline projections to read the
+	// repository while the events they project are not visible yet
+	i.appendMutex.Lock()
+	i.mutex.RLock()
+	err := i.checkLastVersion(expectedVersion)
+	nextPosition := int64(len(i.log) + 1)
+	i.mutex.RUnlock()
+	if err != nil {
+		i.appendMutex.Unlock()
+		return nil, err
+	}
+
+	events := make([]internalEvent, 0, len(raws))
+	inserted := make([]*RawEvent, 0, len(raws))
+	for _, raw := range raws {
+		event := newInternalEventFromRawEvent(raw, i.streamId)
+		event.position = nextPosition + int64(len(events))
+		// ids are unique across streams, for virtual streams to get events by id
+		event.eventId = strconv.FormatInt(event.position, 10)
+		if err := i.projections.run(ctx, nil, event.toRawEvent()); err != nil {
+			i.appendMutex.Unlock()
+			return nil, err
 		}
+		events = append(events, event)
+		inserted = append(inserted, event.toRawEvent())
 	}
+	i.mutex.Lock()
+	i.log = append(i.log, events...)
+	i.events[i.streamId] = append(i.events[i.streamId], events...)
+	listeners := i.streamListeners()
+	i.mutex.Unlock()
+	i.appendMutex.Unlock()
 
-	i.events[i.streamId] = append(i.events[i.streamId], newInternalEventFromRawEvent(raw, i.streamId))
+	for _, event := range events {
+		for _, l := range listeners {
+			l.notify(event.eventId, event.position)
+		}
+	}
+	return inserted, nil
+}
 
-	if i.handler != nil {
-		_ = i.handler(context.Background(), eventId)
+func (i *InMemory) checkLastVersion(expectedVersion string) error {
+	stream := i.currentStream()
+	if len(stream) == 0 {
+		return checkExpectedVersion(expectedVersion, false, "")
+	}
+	lastVersion := stream[len(stream)-1].version
+	if lastVersion == nil {
+		return checkExpectedVersion(expectedVersion, true, "")
 	}
-	return eventId, nil
+	return checkExpectedVersion(expectedVersion, true, *lastVersion)
 }
 
 func (i *InMemory) currentStream() []internalEvent {
 	return i.events[i.streamId]
 }
 
+func (i *InMemory) streamListeners() []*InMemoryListener {
+	listeners := make([]*InMemoryListener, 0)
+	for subscribed, streamListeners := range i.listeners {
+		if !streamMatches(subscribed, i.streamId) {
+			continue
+		}
+		for l := range streamListeners {
+			listeners = append(listeners, l)
+		}
+	}
+	return listeners
+}
+
 func (i *InMemory) AllRawEvents(_ context.Context) ([]*RawEvent, error) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
 	out := make([]*RawEvent, 0)
-	for _, event := range i.events[i.streamId] {
-		if event.streamId != nil && *event.streamId == i.streamId {
+	for _, event := range i.log {
+		if streamMatches(i.streamId, *event.streamId) {
 			out = append(out, event.toRawEvent())
 		}
 	}
 	return out, nil
 }
 
+func (i *InMemory) ReadRawEvents(_ context.Context, fromPosition int64, limit int) ([]*RawEvent, error) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	out := make([]*RawEvent, 0)
+	for _, event := range i.log[min(max(fromPosition-1, 0), int64(len(i.log))):] {
+		if limit > 0 && len(out) == limit {
+			break
+		}
+		if streamMatches(i.streamId, *event.streamId) {
+			out = append(out, event.toRawEvent())
+		}
+	}
+	return out, nil
+}
+
+func (i *InMemory) CountRawEvents(ctx context.Context, fromPosition int64) (int64, error) {
+	events, err := i.ReadRawEvents(ctx, fromPosition, 0)
+	return int64(len(events)), err
+}
+
+func (i *InMemory) HeadPosition(_ context.Context) (int64, error) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	for position := len(i.log); position > 0; position-- {
+		if streamMatches(i.streamId, *i.log[position-1].streamId) {
+			return int64(position), nil
+		}
+	}
+	return 0, nil
+}
+
+func (i *InMemory) SaveSnapshot(_ context.Context, snapshot RawSnapshot) error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if latest, ok := i.snapshots[snapshot.StreamID]; ok && latest.Position > snapshot.Position && latest.SchemaVersion == snapshot.SchemaVersion {
+		return nil
+	}
+	snapshot.CreatedAt = time.Now()
+	i.snapshots[snapshot.StreamID] = snapshot
+	return nil
+}
+
+func (i *InMemory) LatestSnapshot(_ context.Context, streamId string) (*RawSnapshot, error) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	snapshot, ok := i.snapshots[streamId]
+	if !ok {
+		return nil, ErrSnapshotNotFound
+	}
+	return &snapshot, nil
+}
+
+func (i *InMemory) LoadCheckpoint(_ context.Context, name string) (int64, error) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	return i.checkpoints[name], nil
+}
+
+func (i *InMemory) SaveCheckpoint(_ context.Context, name string, position int64, apply func(tx Tx) error) error {
+	if err := apply(nil); err != nil {
+		return err
+	}
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.checkpoints[name] = position
+	return nil
+}
+
+func (i *InMemory) SaveDeadLetter(_ context.Context, _ Tx, letter DeadLetter) error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	letter.CreatedAt = time.Now()
+	i.deadLetters[letter.Name] = append(i.deadLetters[letter.Name], letter)
+	return nil
+}
+
+func (i *InMemory) DeadLetters(_ context.Context, name string) ([]DeadLetter, error) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	return slices.Clone(i.deadLetters[name]), nil
+}
+
+func (i *InMemory) LoadActiveVersion(_ context.Context, name string) (int, error) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	return i.versions[name], nil
+}
+
+func (i *InMemory) SaveActiveVersion(_ context.Context, name string, version int) error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.versions[name] = version
+	return nil
+}
+
 func newInternalEventFromRawEvent(raw RawEvent, streamId string) (i internalEvent) {
 	i.streamId = &streamId
 	i.eventType = &raw.EventType
 	if raw.Version != "" {
 		i.version = &raw.Version
 	}
+	i.contentType = raw.ContentType
 	i.payload = raw.Payload
+	i.createdAt = time.Now()
 	return
 }
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+)
+
+// InMemoryListener is registered on its stream as soon as a handler is set, so that events
+// inserted right after subscribing are not missed, and is removed when Listen returns.
+type InMemoryListener struct {
+	streamId string
+	store    *inMemoryStore
+	handler  handler
+	async    bool
+	pending  *pendingEvents
+}
+
+func (l *InMemoryListener) Handle(h handler) {
+	l.store.mutex.Lock()
+	defer l.store.mutex.Unlock()
+	l.handler = h
+	listeners, ok := l.store.listeners[l.streamId]
+	if !ok {
+		listeners = make(map[*InMemoryListener]struct{})
+		l.store.listeners[l.streamId] = listeners
+	}
+	listeners[l] = struct{}{}
+}
+
+func (l *InMemoryListener) Listen(ctx context.Context) error {
+	defer l.remove()
+
+	if l.async {
+		return l.pending.drain(ctx, l.handler)
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// Listening is closed from the start, as the listener is registered by Handle.
+func (l *InMemoryListener) Listening() <-chan struct{} {
+	return alreadyListening
+}
+
+var alreadyListening = func() chan struct{} {
+	listening := make(chan struct{})
+	close(listening)
+	return listening
+}()
+
+func (l *InMemoryListener) notify(eventID string, position int64) {
+	if l.async {
+		l.pending.push(eventID, position)
+		return
+	}
+	_ = l.handler(context.Background(), eventID)
+}
+
+func (l *InMemoryListener) remove() {
+	l.store.mutex.Lock()
+	defer l.store.mutex.Unlock()
+	delete(l.store.listeners[l.streamId], l)
+	if len(l.store.listeners[l.streamId]) == 0 {
+		delete(l.store.listeners, l.streamId)
+	}
+}
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrJSONQueryNotSupported = errors.New("repository cannot query JSON payloads")
+
+// JSONQuerier is implemented by repositories that can filter events on the contents of
+// their JSON payloads.
+type JSONQuerier interface {
+	// QueryRawEvents reads the events matching predicate, a SQL/JSON path predicate such
+	// as `$.Amount > 1000`, from fromPosition on.
+	QueryRawEvents(ctx context.Context, predicate string, fromPosition int64, limit int) ([]*RawEvent, error)
+}
@@ -1,8 +1,189 @@
 package repository
 
-import "context"
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
 
 type Listener interface {
 	Handle(h handler)
 	Listen(ctx context.Context) error
+	// Listening is closed once the events inserted from then on are handed to the handler.
+	Listening() <-chan struct{}
+}
+
+type handler func(ctx context.Context, eventID string) error
+
+// pendingEventsLimit bounds the events queued for a listener whose handler is slower than
+// the writers.
+const pendingEventsLimit = 1000
+
+// pendingEventsRetryDelay is the wait before reading the stream again, when it failed or
+// did not yet hold the events notified.
+const pendingEventsRetryDelay = 100 * time.Millisecond
+
+type pendingEvent struct {
+	eventID  string
+	position int64
+}
+
+// pendingEvents queues the events notified to a listener, so that whoever notifies it never
+// waits for its handler. Past pendingEventsLimit events, the listener falls behind: events
+// are no longer queued but read again from the stream, by position and a page at a time, as
+// the handler catches up.
+type pendingEvents struct {
+	mutex  sync.Mutex
+	queue  []pendingEvent
+	signal chan struct{}
+	read   func(ctx context.Context, fromPosition int64, limit int) ([]*RawEvent, error)
+
+	behind   bool
+	from     int64
+	notified int64
+	// queued remembers recent positions, as virtual streams can notify an event after one of
+	// a later position: falling behind on the former reads the latter again.
+	queued *positionRing
+}
+
+func newPendingEvents(read func(ctx context.Context, fromPosition int64, limit int) ([]*RawEvent, error)) *pendingEvents {
+	return &pendingEvents{signal: make(chan struct{}, 1), read: read, queued: newPositionRing(2 * pendingEventsLimit)}
+}
+
+func (p *pendingEvents) push(eventID string, position int64) {
+	p.mutex.Lock()
+	p.notified = max(p.notified, position)
+	switch {
+	case p.behind:
+		p.from = min(p.from, position)
+	case len(p.queue) >= pendingEventsLimit:
+		p.behind, p.from = true, position
+	case p.queued.add(position):
+		p.queue = append(p.queue, pendingEvent{eventID: eventID, position: position})
+	}
+	p.mutex.Unlock()
+	p.wake()
+}
+
+// startAt tells that the events up to position are not to be handed to the listener.
+func (p *pendingEvents) startAt(position int64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.notified = max(p.notified, position)
+}
+
+// catchUp reads the stream again past the last event notified, for the events inserted
+// while notifications were not received.
+func (p *pendingEvents) catchUp() {
+	p.mutex.Lock()
+	if p.behind {
+		p.from = min(p.from, p.notified+1)
+	} else {
+		p.behind, p.from = true, p.notified+1
+	}
+	p.mutex.Unlock()
+	p.wake()
+}
+
+func (p *pendingEvents) wake() {
+	select {
+	case p.signal <- struct{}{}:
+	default:
+	}
+}
+
+// take returns the queued events, or reads the next page of the stream when behind. more
+// tells whether take should be called again right away.
+func (p *pendingEvents) take(ctx context.Context) (eventIDs []string, more bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if len(p.queue) > 0 {
+		for _, event := range p.queue {
+			eventIDs = append(eventIDs, event.eventID)
+		}
+		p.queue = nil
+		return eventIDs, true
+	}
+	if !p.behind {
+		return nil, false
+	}
+
+	// events dropped while reading lower from again
+	from := p.from
+	p.from = math.MaxInt64
+	p.mutex.Unlock()
+	raws, err := p.read(ctx, from, pendingEventsLimit)
+	p.mutex.Lock()
+	if err != nil {
+		p.from = min(p.from, from)
+		time.AfterFunc(pendingEventsRetryDelay, p.wake)
+		return nil, false
+	}
+
+	next := from
+	for _, raw := range raws {
+		next = raw.Position + 1
+		p.notified = max(p.notified, raw.Position)
+		if p.queued.add(raw.Position) {
+			eventIDs = append(eventIDs, raw.EventID)
+		}
+	}
+	p.from = min(p.from, next)
+	if len(raws) < pendingEventsLimit && p.from > p.notified {
+		p.behind = false
+		return eventIDs, false
+	}
+	if len(raws) == 0 {
+		// the stream does not show the events notified yet
+		time.AfterFunc(pendingEventsRetryDelay, p.wake)
+		return nil, false
+	}
+	return eventIDs, true
+}
+
+func (p *pendingEvents) drain(ctx context.Context, h handler) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-p.signal:
+			for more := true; more && ctx.Err() == nil; {
+				var eventIDs []string
+				eventIDs, more = p.take(ctx)
+				for _, eventID := range eventIDs {
+					if h != nil {
+						_ = h(ctx, eventID)
+					}
+				}
+			}
+		}
+	}
+}
+
+// positionRing is a set of the last positions added to it.
+type positionRing struct {
+	positions []int64
+	next      int
+	set       map[int64]struct{}
+}
+
+func newPositionRing(size int) *positionRing {
+	return &positionRing{positions: make([]int64, 0, size), set: make(map[int64]struct{}, size)}
+}
+
+// add returns false when position is already in the ring.
+func (r *positionRing) add(position int64) bool {
+	if _, ok := r.set[position]; ok {
+		return false
+	}
+	if len(r.positions) < cap(r.positions) {
+		r.positions = append(r.positions, position)
+	} else {
+		delete(r.set, r.positions[r.next])
+		r.positions[r.next] = position
+		r.next = (r.next + 1) % len(r.positions)
+	}
+	r.set[position] = struct{}{}
+	return true
 }
@@ -2,45 +2,91 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/beevik/guid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/nbarbey/go-event-store/eventstore/codec"
+	"strings"
 	"time"
 )
 
 type RawEvent struct {
+	EventID   string
+	StreamID  string
+	Position  int64
 	EventType string
 	Version   string
-	Payload   []byte
+	// ContentType is the format of Payload, empty for events stored before it was recorded.
+	ContentType string
+	Payload     []byte
+	CreatedAt   time.Time
 }
 
 type Postgres struct {
-	streamId   string
-	connection *pgxpool.Pool
+	streamId    string
+	connection  *pgxpool.Pool
+	notifier    *postgresNotifier
+	projections *inlineProjections
+	jsonb       bool
 }
 
+// Payloads stored as jsonb are read back as their text.
+const eventColumns = "event_id, event_type, version, content_type, stream_id, coalesce(payload, convert_to(payload_json::text, 'UTF8')) as payload, position, created_at"
+
 func NewPostgres(ctx context.Context, connStr string) (*Postgres, error) {
 	connection, err := pgxpool.New(ctx, connStr)
 	if err != nil {
 		return nil, fmt.Errorf("unable to connect to database: %w", err)
 	}
 
-	p := &Postgres{streamId: "default-stream", connection: connection}
+	p := &Postgres{
+		streamId:    "default-stream",
+		connection:  connection,
+		notifier:    newPostgresNotifier(connection.Config().ConnConfig),
+		projections: &inlineProjections{},
+	}
 	_, err = p.CreateTableAndTrigger(ctx)
 	return p, err
 }
 
 func (r *Postgres) Stream(name string) Repository {
-	r.streamId = name
-	return r
+	return &Postgres{streamId: name, connection: r.connection, notifier: r.notifier, projections: r.projections, jsonb: r.jsonb}
+}
+
+// WithJSONBPayloads stores the payloads of JSON events in a jsonb column rather than as
+// bytes, for QueryRawEvents to look into them. Other payloads, including JSON that has been
+// compressed or encrypted, or that jsonb rejects, are still stored as bytes.
+//
+// jsonb normalises documents: payloads stored as jsonb are read back with keys reordered,
+// whitespace dropped and only the last of duplicate keys, which decode to the same events
+// but are not the bytes that were written.
+func (r *Postgres) WithJSONBPayloads() *Postgres {
+	out := *r
+	out.jsonb = true
+	return &out
+}
+
+func (r *Postgres) AddInlineProjection(projection InlineProjection) (remove func()) {
+	return r.projections.add(projection)
+}
+
+func (r *Postgres) Close() {
+	r.notifier.close()
+	r.connection.Close()
 }
 
 func (r *Postgres) GetRawEvent(ctx context.Context, eventId string) (*RawEvent, error) {
-	row := r.connection.QueryRow(ctx, "select event_type, version, payload from events where event_id=$1 and stream_id=$2", eventId, r.streamId)
+	condition, args := r.streamCondition(2)
+	row := r.connection.QueryRow(ctx,
+		"select "+eventColumns+" from events where event_id=$1 and "+condition,
+		append([]any{eventId}, args...)...)
 	var er eventRow
-	err := row.Scan(&er.EventType, &er.Version, &er.Payload)
+	err := row.Scan(&er.EventID, &er.EventType, &er.Version, &er.ContentType, &er.StreamID, &er.Payload, &er.Position, &er.CreatedAt)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, ErrEventNotFound
 	}
@@ -51,26 +97,123 @@ func (r *Postgres) GetRawEvent(ctx context.Context, eventId string) (*RawEvent,
 }
 
 func (r *Postgres) InsertRawEvent(ctx context.Context, raw RawEvent, expectedVersion string) (string, error) {
-	if expectedVersion != "" {
-		row := r.connection.QueryRow(ctx,
-			"select event_id from events where stream_id=$1 and version=$2",
-			r.streamId, expectedVersion)
-		var eventIDWithExpectedVersion string
-		err := row.Scan(&eventIDWithExpectedVersion)
-		if errors.Is(err, pgx.ErrNoRows) {
-			return "", ErrVersionMismatch
+	inserted, err := r.InsertRawEvents(ctx, []RawEvent{raw}, expectedVersion)
+	if err != nil {
+		return "", err
+	}
+	return inserted[0].EventID, nil
+}
+
+func (r *Postgres) InsertRawEvents(ctx context.Context, raws []RawEvent, expectedVersion string) ([]*RawEvent, error) {
+	if isVirtualStream(r.streamId) {
+		return nil, ErrVirtualStream
+	}
+
+	var inserted []*RawEvent
+	err := pgx.BeginFunc(ctx, r.connection, func(tx pgx.Tx) error {
+		// the transaction id is assigned before the positions are taken, see settledCondition
+		_, err := tx.Exec(ctx, "select pg_advisory_xact_lock(hashtext($1)), pg_current_xact_id()", r.streamId)
+		if err != nil {
+			return err
 		}
+		err = r.checkLastVersion(ctx, tx, expectedVersion)
+		if err != nil {
+			return err
+		}
+		positions, err := takePositions(ctx, tx, len(raws))
+		if err != nil {
+			return err
+		}
+
+		inserted = make([]*RawEvent, 0, len(raws))
+		createdAt := time.Now()
+		for i, raw := range raws {
+			raw.EventID, raw.StreamID, raw.CreatedAt, raw.Position = guid.New().String(), r.streamId, createdAt, positions[i]
+			err = r.insert(ctx, tx, &raw)
+			if err != nil {
+				return err
+			}
+			err = r.projections.run(ctx, tx, &raw)
+			if err != nil {
+				return err
+			}
+			inserted = append(inserted, &raw)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return inserted, nil
+}
 
-	eventId := guid.New().String()
-	_, err := r.connection.Exec(ctx,
-		"insert into events (event_id, stream_id, event_type, version, payload, created_at) values ($1, $2, $3, $4, $5, $6)",
-		eventId, r.streamId, raw.EventType, raw.Version, raw.Payload, time.Now())
-	return eventId, err
+func (r *Postgres) insert(ctx context.Context, tx pgx.Tx, raw *RawEvent) error {
+	payload, payloadJSON := r.splitPayload(*raw)
+	if payloadJSON != nil {
+		// jsonb rejects some valid JSON, such as strings holding \u0000: those payloads are
+		// stored as bytes, in a savepoint so that the transaction survives the attempt
+		err := pgx.BeginFunc(ctx, tx, func(tx pgx.Tx) error {
+			return insertRow(ctx, tx, raw, nil, payloadJSON)
+		})
+		var pgErr *pgconn.PgError
+		if !errors.As(err, &pgErr) || pgErr.Code[:2] != dataExceptionClass {
+			return err
+		}
+		payload = raw.Payload
+	}
+	return insertRow(ctx, tx, raw, payload, nil)
+}
+
+const dataExceptionClass = "22"
+
+func takePositions(ctx context.Context, tx pgx.Tx, count int) ([]int64, error) {
+	rows, err := tx.Query(ctx, "select nextval(pg_get_serial_sequence('events', 'position')) from generate_series(1, $1) order by 1", count)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int64])
+}
+
+// insertRow runs in a statement of its own, after the positions are taken: the snapshot
+// giving the horizon of the event is taken then.
+func insertRow(ctx context.Context, tx pgx.Tx, raw *RawEvent, payload []byte, payloadJSON *string) error {
+	_, err := tx.Exec(ctx,
+		"insert into events (event_id, stream_id, event_type, version, content_type, payload, payload_json, created_at, position, horizon) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, pg_snapshot_xmax(pg_current_snapshot()))",
+		raw.EventID, raw.StreamID, raw.EventType, raw.Version, raw.ContentType, payload, payloadJSON, raw.CreatedAt, raw.Position)
+	return err
+}
+
+func (r *Postgres) splitPayload(raw RawEvent) (payload []byte, payloadJSON *string) {
+	if r.jsonb && raw.ContentType == codec.ContentTypeJSON && json.Valid(raw.Payload) {
+		document := string(raw.Payload)
+		return nil, &document
+	}
+	return raw.Payload, nil
+}
+
+func (r *Postgres) checkLastVersion(ctx context.Context, tx pgx.Tx, expectedVersion string) error {
+	if expectedVersion == "" {
+		return nil
+	}
+	row := tx.QueryRow(ctx,
+		"select version from events where stream_id=$1 order by position desc limit 1",
+		r.streamId)
+	var lastVersion sql.NullString
+	err := row.Scan(&lastVersion)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return checkExpectedVersion(expectedVersion, false, "")
+	}
+	if err != nil {
+		return err
+	}
+	return checkExpectedVersion(expectedVersion, true, lastVersion.String)
 }
 
 func (r *Postgres) AllRawEvents(ctx context.Context) ([]*RawEvent, error) {
-	rows, err := r.connection.Query(ctx, "select event_id, event_type, version, stream_id, payload from events where stream_id=$1 order by created_at desc", r.streamId)
+	condition, args := r.readCondition(1)
+	rows, err := r.connection.Query(ctx,
+		"select "+eventColumns+" from events where "+condition+" order by position",
+		args...)
 	if err != nil {
 		return nil, err
 	}
@@ -81,8 +224,176 @@ func (r *Postgres) AllRawEvents(ctx context.Context) ([]*RawEvent, error) {
 	return eventRows(sliceOfEventRows).ToRawEvents(), nil
 }
 
+func (r *Postgres) ReadRawEvents(ctx context.Context, fromPosition int64, limit int) ([]*RawEvent, error) {
+	condition, args := r.readCondition(2)
+	query := "select " + eventColumns + " from events where position>=$1 and " + condition + " order by position"
+	return r.queryRawEvents(ctx, query, limit, append([]any{fromPosition}, args...)...)
+}
+
+// QueryRawEvents only sees payloads stored as jsonb. Predicates on equality, like
+// `$.Currency == "EUR"`, can use the index created by CreateJSONBIndex.
+func (r *Postgres) QueryRawEvents(ctx context.Context, predicate string, fromPosition int64, limit int) ([]*RawEvent, error) {
+	condition, args := r.readCondition(3)
+	query := "select " + eventColumns + " from events where payload_json @@ $1::jsonpath and position>=$2 and " + condition + " order by position"
+	return r.queryRawEvents(ctx, query, limit, append([]any{predicate, fromPosition}, args...)...)
+}
+
+func (r *Postgres) queryRawEvents(ctx context.Context, query string, limit int, args ...any) ([]*RawEvent, error) {
+	if limit > 0 {
+		query += fmt.Sprintf(" limit %d", limit)
+	}
+	rows, err := r.connection.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	sliceOfEventRows, err := pgx.CollectRows(rows, pgx.RowToStructByName[eventRow])
+	if err != nil {
+		return nil, fmt.Errorf("CollectRows error: %w", err)
+	}
+	return eventRows(sliceOfEventRows).ToRawEvents(), nil
+}
+
+func (r *Postgres) CountRawEvents(ctx context.Context, fromPosition int64) (int64, error) {
+	condition, args := r.readCondition(2)
+	var count int64
+	err := r.connection.QueryRow(ctx, "select count(*) from events where position>=$1 and "+condition, append([]any{fromPosition}, args...)...).Scan(&count)
+	return count, err
+}
+
+func (r *Postgres) HeadPosition(ctx context.Context) (int64, error) {
+	condition, args := r.readCondition(1)
+	var position int64
+	err := r.connection.QueryRow(ctx, "select coalesce(max(position), 0) from events where "+condition, args...).Scan(&position)
+	return position, err
+}
+
+func (r *Postgres) SaveSnapshot(ctx context.Context, snapshot RawSnapshot) error {
+	_, err := r.connection.Exec(ctx,
+		`insert into snapshots (stream_id, revision, position, schema_version, payload, created_at) values ($1, $2, $3, $4, $5, $6)
+		on conflict (stream_id) do update set revision=excluded.revision, position=excluded.position, schema_version=excluded.schema_version, payload=excluded.payload, created_at=excluded.created_at
+		where snapshots.position <= excluded.position or snapshots.schema_version <> excluded.schema_version`,
+		snapshot.StreamID, snapshot.Revision, snapshot.Position, snapshot.SchemaVersion, snapshot.Payload, time.Now())
+	return err
+}
+
+func (r *Postgres) LatestSnapshot(ctx context.Context, streamId string) (*RawSnapshot, error) {
+	row := r.connection.QueryRow(ctx,
+		"select stream_id, revision, position, schema_version, payload, created_at from snapshots where stream_id=$1",
+		streamId)
+	var snapshot RawSnapshot
+	err := row.Scan(&snapshot.StreamID, &snapshot.Revision, &snapshot.Position, &snapshot.SchemaVersion, &snapshot.Payload, &snapshot.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSnapshotNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+func (r *Postgres) LoadCheckpoint(ctx context.Context, name string) (int64, error) {
+	var position int64
+	err := r.connection.QueryRow(ctx, "select position from checkpoints where name=$1", name).Scan(&position)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	return position, err
+}
+
+func (r *Postgres) SaveCheckpoint(ctx context.Context, name string, position int64, apply func(tx Tx) error) error {
+	return pgx.BeginFunc(ctx, r.connection, func(tx pgx.Tx) error {
+		if err := apply(tx); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx,
+			`insert into checkpoints (name, position, updated_at) values ($1, $2, $3)
+			on conflict (name) do update set position=excluded.position, updated_at=excluded.updated_at`,
+			name, position, time.Now())
+		return err
+	})
+}
+
+func (r *Postgres) SaveDeadLetter(ctx context.Context, tx Tx, letter DeadLetter) error {
+	_, err := r.querier(tx).Exec(ctx,
+		`insert into dead_letters (name, position, event_id, error, created_at) values ($1, $2, $3, $4, $5)
+		on conflict (name, position) do update set error=excluded.error, created_at=excluded.created_at`,
+		letter.Name, letter.Position, letter.EventID, letter.Error, time.Now())
+	return err
+}
+
+func (r *Postgres) DeadLetters(ctx context.Context, name string) ([]DeadLetter, error) {
+	rows, err := r.connection.Query(ctx,
+		"select name, position, event_id, error, created_at from dead_letters where name=$1 order by position", name)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByPos[DeadLetter])
+}
+
+type querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// querier runs in tx when a projection passes one, on the pool otherwise.
+func (r *Postgres) querier(tx Tx) querier {
+	if tx, ok := tx.(pgx.Tx); ok {
+		return tx
+	}
+	return r.connection
+}
+
+func (r *Postgres) LoadActiveVersion(ctx context.Context, name string) (int, error) {
+	var version int
+	err := r.connection.QueryRow(ctx, "select active from projection_versions where name=$1", name).Scan(&version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	return version, err
+}
+
+func (r *Postgres) SaveActiveVersion(ctx context.Context, name string, version int) error {
+	_, err := r.connection.Exec(ctx,
+		`insert into projection_versions (name, active, updated_at) values ($1, $2, $3)
+		on conflict (name) do update set active=excluded.active, updated_at=excluded.updated_at`,
+		name, version, time.Now())
+	return err
+}
+
+func (r *Postgres) streamCondition(argIndex int) (string, []any) {
+	switch {
+	case r.streamId == AllStreams:
+		return "stream_id not like '$%'", nil
+	case isVirtualStream(r.streamId):
+		// a prefix match, unlike split_part, can use stream_pattern_index
+		return fmt.Sprintf("stream_id like $%d", argIndex), []any{likeEscaper.Replace(strings.TrimPrefix(r.streamId, categoryPrefix)) + "-%"}
+	default:
+		return fmt.Sprintf("stream_id=$%d", argIndex), []any{r.streamId}
+	}
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// readCondition holds virtual streams back to settledCondition, while events of a stream are
+// appended one transaction at a time and committed in the order of their positions.
+func (r *Postgres) readCondition(argIndex int) (string, []any) {
+	condition, args := r.streamCondition(argIndex)
+	if isVirtualStream(r.streamId) {
+		condition += " and " + settledCondition
+	}
+	return condition, args
+}
+
+// Positions are taken before commit, so that an event can become visible after a later one,
+// written concurrently to another stream: readers checkpointing the later one would skip it.
+// settledCondition stops at the last event whose horizon, the first transaction id not yet
+// assigned once its position was taken, is older than every running transaction: all the
+// positions before it belong to transactions that have ended. Events written before there
+// was a horizon count as settled.
+const settledCondition = `position <= coalesce((select position from events where horizon is null or horizon <= pg_snapshot_xmin(pg_current_snapshot()) order by position desc limit 1), 0)`
+
 func (r *Postgres) NewListener() Listener {
-	return NewPostgresListener(r.streamId, r.connection)
+	return newPostgresListener(r)
 }
 
 func (r *Postgres) CreateTableAndTrigger(ctx context.Context) (*Postgres, error) {
@@ -94,6 +405,22 @@ func (r *Postgres) CreateTableAndTrigger(ctx context.Context) (*Postgres, error)
 	if err != nil {
 		return r, err
 	}
+	err = r.createSnapshotsTable(ctx)
+	if err != nil {
+		return r, err
+	}
+	err = r.createCheckpointsTable(ctx)
+	if err != nil {
+		return r, err
+	}
+	err = r.createProjectionVersionsTable(ctx)
+	if err != nil {
+		return r, err
+	}
+	err = r.createDeadLettersTable(ctx)
+	if err != nil {
+		return r, err
+	}
 	err = r.createNotificationFunction(ctx)
 	if err != nil {
 		return r, err
@@ -103,7 +430,73 @@ func (r *Postgres) CreateTableAndTrigger(ctx context.Context) (*Postgres, error)
 
 func (r *Postgres) createEventsTable(ctx context.Context) error {
 	_, err := r.connection.Exec(ctx,
-		"create table if not exists events (event_id text, stream_id text, event_type text, version text, payload bytea, created_at timestamp )")
+		"create table if not exists events (event_id text, stream_id text, event_type text, version text, content_type text, payload bytea, payload_json jsonb, created_at timestamptz, position bigserial, horizon xid8)")
+	if err != nil {
+		return err
+	}
+	_, err = r.connection.Exec(ctx, "alter table events add column if not exists position bigserial")
+	if err != nil {
+		return err
+	}
+	_, err = r.connection.Exec(ctx, "alter table events add column if not exists content_type text")
+	if err != nil {
+		return err
+	}
+	_, err = r.connection.Exec(ctx, "alter table events add column if not exists payload_json jsonb")
+	if err != nil {
+		return err
+	}
+	_, err = r.connection.Exec(ctx, "alter table events add column if not exists horizon xid8")
+	if err != nil {
+		return err
+	}
+	return r.migrateToTimestamptz(ctx, "events", "created_at")
+}
+
+func (r *Postgres) createSnapshotsTable(ctx context.Context) error {
+	_, err := r.connection.Exec(ctx,
+		"create table if not exists snapshots (stream_id text primary key, revision text, position bigint, schema_version integer not null default 0, payload bytea, created_at timestamptz)")
+	if err != nil {
+		return err
+	}
+	return r.migrateToTimestamptz(ctx, "snapshots", "created_at")
+}
+
+func (r *Postgres) createCheckpointsTable(ctx context.Context) error {
+	_, err := r.connection.Exec(ctx,
+		"create table if not exists checkpoints (name text primary key, position bigint, updated_at timestamptz)")
+	if err != nil {
+		return err
+	}
+	return r.migrateToTimestamptz(ctx, "checkpoints", "updated_at")
+}
+
+// migrateToTimestamptz converts a column created as a timestamp, which held the wall clock
+// of the application, taken to be in its current time zone.
+func (r *Postgres) migrateToTimestamptz(ctx context.Context, table, column string) error {
+	var dataType string
+	err := r.connection.QueryRow(ctx,
+		"select data_type from information_schema.columns where table_schema=current_schema() and table_name=$1 and column_name=$2",
+		table, column).Scan(&dataType)
+	if err != nil || dataType != "timestamp without time zone" {
+		return err
+	}
+	_, offset := time.Now().Zone()
+	columnName := pgx.Identifier{column}.Sanitize()
+	_, err = r.connection.Exec(ctx, fmt.Sprintf("alter table %s alter column %s type timestamptz using %s at time zone interval '%d seconds'",
+		pgx.Identifier{table}.Sanitize(), columnName, columnName, offset))
+	return err
+}
+
+func (r *Postgres) createProjectionVersionsTable(ctx context.Context) error {
+	_, err := r.connection.Exec(ctx,
+		"create table if not exists projection_versions (name text primary key, active integer not null, updated_at timestamptz)")
+	return err
+}
+
+func (r *Postgres) createDeadLettersTable(ctx context.Context) error {
+	_, err := r.connection.Exec(ctx,
+		"create table if not exists dead_letters (name text, position bigint, event_id text, error text, created_at timestamptz, primary key (name, position))")
 	return err
 }
 
@@ -115,14 +508,26 @@ func (r *Postgres) createNewEventNotificationTrigger(ctx context.Context) error
 }
 
 func (r *Postgres) createNotificationFunction(ctx context.Context) error {
-	_, err := r.connection.Exec(ctx, `create or replace function "doNotify"()
+	_, err := r.connection.Exec(ctx, fmt.Sprintf(`create or replace function "doNotify"()
   		returns trigger as $$
 			declare 
 			begin
-  			perform pg_notify(new.stream_id, new.event_id);
+  			perform pg_notify('%s', json_build_object(
+  				'stream_id', left(new.stream_id, %d),
+  				'stream_id_truncated', length(new.stream_id) > %d,
+  				'event_id', new.event_id,
+  				'event_type', new.event_type,
+  				'position', new.position)::text);
   		return new;
 		end;
-		$$ language plpgsql;`)
+		$$ language plpgsql;`, notificationChannel, notifiedStreamIDLength, notifiedStreamIDLength))
+	return err
+}
+
+// CreateJSONBIndex adds a GIN index on the payloads stored as jsonb. It is left to the
+// caller as it slows inserts down.
+func (r *Postgres) CreateJSONBIndex(ctx context.Context) error {
+	_, err := r.connection.Exec(ctx, `create index if not exists payload_json_index on events using gin (payload_json jsonb_path_ops)`)
 	return err
 }
 
@@ -136,5 +541,17 @@ func (r *Postgres) createIndex(ctx context.Context) error {
 		return err
 	}
 	_, err = r.connection.Exec(ctx, `create unique index if not exists stream_event_index on events (event_id, stream_id)`)
+	if err != nil {
+		return err
+	}
+	_, err = r.connection.Exec(ctx, `create index if not exists stream_position_index on events (stream_id, position)`)
+	if err != nil {
+		return err
+	}
+	_, err = r.connection.Exec(ctx, `create index if not exists stream_pattern_index on events (stream_id text_pattern_ops)`)
+	if err != nil {
+		return err
+	}
+	_, err = r.connection.Exec(ctx, `create index if not exists position_index on events (position)`)
 	return err
 }
@@ -2,34 +2,50 @@ package repository
 
 import (
 	"context"
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgconn"
-	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/jackc/pgxlisten"
+	"fmt"
 )
 
 type PostgresListener struct {
-	streamId string
-	listener *pgxlisten.Listener
+	streamId  string
+	notifier  *postgresNotifier
+	head      func(ctx context.Context) (int64, error)
+	handler   handler
+	pending   *pendingEvents
+	listening chan struct{}
 }
 
-func NewPostgresListener(streamId string, connection *pgxpool.Pool) *PostgresListener {
-	listener := pgxlisten.Listener{}
-	listener.Connect = func(ctx context.Context) (*pgx.Conn, error) {
-		conn, err := connection.Acquire(ctx)
-		return conn.Conn(), err
+func newPostgresListener(r *Postgres) *PostgresListener {
+	return &PostgresListener{
+		streamId:  r.streamId,
+		notifier:  r.notifier,
+		head:      r.HeadPosition,
+		pending:   newPendingEvents(r.ReadRawEvents),
+		listening: make(chan struct{}),
 	}
-	return &PostgresListener{streamId: streamId, listener: &listener}
 }
 
-type handler func(ctx context.Context, eventID string) error
-
 func (t *PostgresListener) Handle(h handler) {
-	t.listener.Handle(t.streamId, pgxlisten.HandlerFunc(func(ctx context.Context, notification *pgconn.Notification, conn *pgx.Conn) error {
-		return h(ctx, notification.Payload)
-	}))
+	t.handler = h
 }
 
+// Listen hands the events inserted past the head of the stream to the handler, including
+// those inserted before LISTEN took effect, which are read again once it has.
 func (t *PostgresListener) Listen(ctx context.Context) error {
-	return t.listener.Listen(ctx)
+	head, err := t.head(ctx)
+	if err != nil {
+		return fmt.Errorf("reading head of %q: %w", t.streamId, err)
+	}
+	t.pending.startAt(head)
+
+	if err := t.notifier.subscribe(ctx, t); err != nil {
+		return err
+	}
+	defer t.notifier.unsubscribe(t)
+	close(t.listening)
+
+	return t.pending.drain(ctx, t.handler)
+}
+
+func (t *PostgresListener) Listening() <-chan struct{} {
+	return t.listening
 }
@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"sync"
+	"time"
+)
+
+const notificationChannel = "eventstore_events"
+
+const notifierReconnectDelay = time.Second
+
+// notifiedStreamIDLength is the number of characters of the stream id sent in notifications,
+// whose payloads are limited to 8000 bytes: longer stream ids are truncated.
+const notifiedStreamIDLength = 1000
+
+var errNotifierClosed = errors.New("repository closed")
+
+type notification struct {
+	StreamID          string `json:"stream_id"`
+	StreamIDTruncated bool   `json:"stream_id_truncated"`
+	EventID           string `json:"event_id"`
+	EventType         string `json:"event_type"`
+	Position          int64  `json:"position"`
+}
+
+// postgresNotifier owns a single connection, opened outside the pool, on which it LISTENs
+// to the events channel and fans notifications out to the in-process listeners by stream.
+// Notifications sent while it reconnects are lost: once LISTEN is in effect again, the
+// listeners read their stream again past the last event they were notified.
+type postgresNotifier struct {
+	connConfig  *pgx.ConnConfig
+	mutex       sync.Mutex
+	subscribers map[string]map[*PostgresListener]struct{}
+	listening   chan struct{}
+	// failed is closed, and replaced, whenever LISTEN could not be put in effect, with err.
+	failed chan struct{}
+	err    error
+	start  sync.Once
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newPostgresNotifier(connConfig *pgx.ConnConfig) *postgresNotifier {
+	return &postgresNotifier{
+		connConfig:  connConfig,
+		subscribers: make(map[string]map[*PostgresListener]struct{}),
+		listening:   make(chan struct{}),
+		failed:      make(chan struct{}),
+		cancel:      func() {},
+	}
+}
+
+// subscribe returns once LISTEN is in effect, after which l catches up with the events
+// inserted before, or with the error of the next attempt to put it in effect when it fails.
+func (n *postgresNotifier) subscribe(ctx context.Context, l *PostgresListener) error {
+	n.start.Do(func() {
+		var ctx context.Context
+		ctx, n.cancel = context.WithCancel(context.Background())
+		n.done = make(chan struct{})
+		go n.run(ctx)
+	})
+	if n.done == nil {
+		return errNotifierClosed
+	}
+
+	n.mutex.Lock()
+	listeners, ok := n.subscribers[l.streamId]
+	if !ok {
+		listeners = make(map[*PostgresListener]struct{})
+		n.subscribers[l.streamId] = listeners
+	}
+	listeners[l] = struct{}{}
+	listening, failed := n.listening, n.failed
+	n.mutex.Unlock()
+
+	select {
+	case <-listening:
+	case <-failed:
+		n.unsubscribe(l)
+		n.mutex.Lock()
+		defer n.mutex.Unlock()
+		return n.err
+	case <-n.done:
+		n.unsubscribe(l)
+		return errNotifierClosed
+	case <-ctx.Done():
+		n.unsubscribe(l)
+		return ctx.Err()
+	}
+	l.pending.catchUp()
+	return nil
+}
+
+func (n *postgresNotifier) unsubscribe(l *PostgresListener) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	delete(n.subscribers[l.streamId], l)
+	if len(n.subscribers[l.streamId]) == 0 {
+		delete(n.subscribers, l.streamId)
+	}
+}
+
+func (n *postgresNotifier) close() {
+	n.start.Do(func() {})
+	n.cancel()
+	if n.done != nil {
+		<-n.done
+	}
+}
+
+func (n *postgresNotifier) run(ctx context.Context) {
+	defer close(n.done)
+	for ctx.Err() == nil {
+		// listeners waiting for LISTEN get the errors putting it in effect, the others
+		// catch up once it is in effect again
+		_ = n.listen(ctx)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(notifierReconnectDelay):
+		}
+	}
+}
+
+func (n *postgresNotifier) listen(ctx context.Context) error {
+	conn, err := pgx.ConnectConfig(ctx, n.connConfig)
+	if err != nil {
+		return n.fail(fmt.Errorf("connect: %w", err))
+	}
+	defer func() { _ = conn.Close(context.Background()) }()
+
+	_, err = conn.Exec(ctx, "listen "+pgx.Identifier{notificationChannel}.Sanitize())
+	if err != nil {
+		return n.fail(fmt.Errorf("listen %q: %w", notificationChannel, err))
+	}
+	n.setListening()
+	defer n.resetListening()
+
+	for {
+		pgNotification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("waiting for notification: %w", err)
+		}
+		n.dispatch(pgNotification)
+	}
+}
+
+// setListening releases the listeners waiting for LISTEN to take effect, and has the others
+// catch up with the events inserted while reconnecting.
+func (n *postgresNotifier) setListening() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	close(n.listening)
+	for _, listeners := range n.subscribers {
+		for l := range listeners {
+			l.pending.catchUp()
+		}
+	}
+}
+
+// fail hands err to the listeners waiting for LISTEN to take effect.
+func (n *postgresNotifier) fail(err error) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.err = err
+	close(n.failed)
+	n.failed = make(chan struct{})
+	return err
+}
+
+func (n *postgresNotifier) resetListening() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.listening = make(chan struct{})
+}
+
+func (n *postgresNotifier) dispatch(pgNotification *pgconn.Notification) {
+	var notif notification
+	if err := json.Unmarshal([]byte(pgNotification.Payload), &notif); err != nil {
+		return
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	for subscribed, listeners := range n.subscribers {
+		switch {
+		// virtual streams match by prefix, which a truncated stream id may be enough for
+		case streamMatches(subscribed, notif.StreamID) && (!notif.StreamIDTruncated || isVirtualStream(subscribed)):
+			for l := range listeners {
+				l.pending.push(notif.EventID, notif.Position)
+			}
+		case notif.StreamIDTruncated && streamMayMatch(subscribed, notif.StreamID):
+			// the listeners read their stream again, to tell whether the event is theirs
+			for l := range listeners {
+				l.pending.catchUp()
+			}
+		}
+	}
+}
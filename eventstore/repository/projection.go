@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var ErrInlineProjectionsNotSupported = errors.New("inline projections not supported")
+
+// Tx is the transaction projections write their read models in, atomically with the events
+// or the checkpoint they follow: a pgx.Tx on PostgreSQL, nil in memory.
+type Tx any
+
+// InlineProjection runs inside the transaction appending raw: returning an error rolls the
+// append back.
+type InlineProjection func(ctx context.Context, tx Tx, raw *RawEvent) error
+
+// InlineProjector is implemented by the repositories that run inline projections, on the
+// events appended to any of their streams.
+type InlineProjector interface {
+	// AddInlineProjection returns a function removing the projection.
+	AddInlineProjection(projection InlineProjection) (remove func())
+}
+
+type inlineProjection struct {
+	id         int
+	projection InlineProjection
+}
+
+type inlineProjections struct {
+	mutex       sync.RWMutex
+	lastId      int
+	projections []inlineProjection
+}
+
+func (p *inlineProjections) add(projection InlineProjection) (remove func()) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.lastId++
+	id := p.lastId
+	p.projections = append(p.projections, inlineProjection{id: id, projection: projection})
+	return func() {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		for i, added := range p.projections {
+			if added.id == id {
+				p.projections = append(p.projections[:i:i], p.projections[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (p *inlineProjections) run(ctx context.Context, tx Tx, raw *RawEvent) error {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	for _, added := range p.projections {
+		if err := added.projection(ctx, tx, raw); err != nil {
+			return fmt.Errorf("inline projection: %w", err)
+		}
+	}
+	return nil
+}
@@ -9,9 +9,37 @@ type Repository interface {
 	Stream(name string) Repository
 	GetRawEvent(ctx context.Context, eventId string) (*RawEvent, error)
 	InsertRawEvent(ctx context.Context, raw RawEvent, expectedVersion string) (string, error)
+	// InsertRawEvents appends all the raws or none of them, checking expectedVersion once
+	// before the first, and returns them as stored.
+	InsertRawEvents(ctx context.Context, raws []RawEvent, expectedVersion string) ([]*RawEvent, error)
+	// AllRawEvents returns the events of the stream oldest first, in position order.
 	AllRawEvents(ctx context.Context) ([]*RawEvent, error)
+	ReadRawEvents(ctx context.Context, fromPosition int64, limit int) ([]*RawEvent, error)
+	CountRawEvents(ctx context.Context, fromPosition int64) (int64, error)
+	HeadPosition(ctx context.Context) (int64, error)
 	NewListener() Listener
 }
 
+// NoStream is the expected version of a stream that must not have any event yet. Any other
+// non-empty expected version must be the version of the last event of the stream.
+const NoStream = "$no-stream"
+
 var ErrEventNotFound = errors.New("event not found")
 var ErrVersionMismatch = errors.New("mismatched version")
+var ErrVirtualStream = errors.New("cannot append to a virtual stream")
+var ErrEventSkipped = errors.New("event skipped")
+
+func checkExpectedVersion(expectedVersion string, streamExists bool, lastVersion string) error {
+	switch {
+	case expectedVersion == "":
+		return nil
+	case expectedVersion == NoStream:
+		if streamExists {
+			return ErrVersionMismatch
+		}
+		return nil
+	case !streamExists || lastVersion != expectedVersion:
+		return ErrVersionMismatch
+	}
+	return nil
+}
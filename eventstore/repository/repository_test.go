@@ -2,7 +2,9 @@ package repository_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/jackc/pgx/v5"
 	"github.com/nbarbey/go-event-store/eventstore/repository"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -11,6 +13,9 @@ import (
 	"github.com/testcontainers/testcontainers-go/wait"
 	"log"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -40,7 +45,32 @@ func TestPostgres(t *testing.T) {
 	t.Run("Insert and Get All in Stream", testInsertAndGetAllInStream(r))
 	t.Run("Insert with unexpected version", testInsertWithUnexpectedVeresion(r))
 	t.Run("Insert with expected version", testInsertWithExpectedVersion(r))
+	t.Run("Insert with outdated expected version", testInsertWithOutdatedExpectedVersion(r))
+	t.Run("Insert with no stream expected", testInsertWithNoStreamExpected(r))
+	t.Run("Insert with expected version on empty stream", testInsertWithExpectedVersionOnEmptyStream(r))
+	t.Run("Insert several events at once", testInsertRawEvents(r))
 	t.Run("listener", testListener(r))
+	t.Run("listener on long stream name", testListenerOnStream(r, strings.Repeat("very-long-stream-name-", 10)))
+	t.Run("listener on unicode stream name", testListenerOnStream(r, "compte-épargne-日本語-🐷"))
+	t.Run("listener on stream name with quotes", testListenerOnStream(r, `it's a "stream"`))
+	t.Run("listeners on stream names over 8000 bytes", testListenersOnHugeStreamNames(r))
+	t.Run("many listeners", testManyListeners(r))
+	t.Run("several listeners on same stream", testSeveralListenersOnSameStream(r))
+	t.Run("virtual streams", testVirtualStreams(r))
+	t.Run("categories holding dashes", testCategoriesHoldingDashes(r))
+	t.Run("system streams", testSystemStreams(r))
+	t.Run("snapshots", testSnapshots(newPostgres))
+	t.Run("inline projections", testInlineProjections(r))
+	t.Run("checkpoints", testCheckpoints(newPostgres))
+	t.Run("active versions", testActiveVersions(newPostgres))
+	t.Run("dead letters", testDeadLetters(newPostgres))
+	t.Run("content types", testContentTypes(r))
+	t.Run("creation time", testCreationTime(r))
+	t.Run("inline projection writes in the append transaction", testInlineProjectionTransaction(r, connectionString))
+	t.Run("virtual streams wait for concurrent appends", testVirtualStreamsWaitForConcurrentAppends(r))
+	t.Run("listener catches up after reconnecting", testListenerCatchesUpAfterReconnecting(r, connectionString))
+	t.Run("listening fails when LISTEN cannot take effect", testListeningFailsWithoutNotifications(connectionString))
+	t.Run("jsonb payloads", testJSONBPayloads(newPostgres))
 }
 
 func TestInMemory(t *testing.T) {
@@ -51,29 +81,661 @@ func TestInMemory(t *testing.T) {
 	t.Run("Insert and Get All in Stream", testInsertAndGetAllInStream(r))
 	t.Run("Insert with unexpected version", testInsertWithUnexpectedVeresion(r))
 	t.Run("Insert with expected version", testInsertWithExpectedVersion(r))
+	t.Run("Insert with outdated expected version", testInsertWithOutdatedExpectedVersion(r))
+	t.Run("Insert with no stream expected", testInsertWithNoStreamExpected(r))
+	t.Run("Insert with expected version on empty stream", testInsertWithExpectedVersionOnEmptyStream(r))
+	t.Run("Insert several events at once", testInsertRawEvents(r))
 	t.Run("listener", testListener(r))
+	t.Run("listener on long stream name", testListenerOnStream(r, strings.Repeat("very-long-stream-name-", 10)))
+	t.Run("listener on unicode stream name", testListenerOnStream(r, "compte-épargne-日本語-🐷"))
+	t.Run("listener on stream name with quotes", testListenerOnStream(r, `it's a "stream"`))
+	t.Run("listeners on stream names over 8000 bytes", testListenersOnHugeStreamNames(r))
+	t.Run("many listeners", testManyListeners(r))
+	t.Run("several listeners on same stream", testSeveralListenersOnSameStream(r))
+	t.Run("virtual streams", testVirtualStreams(r))
+	t.Run("categories holding dashes", testCategoriesHoldingDashes(r))
+	t.Run("system streams", testSystemStreams(r))
+	t.Run("snapshots", testSnapshots(r))
+	t.Run("inline projections", testInlineProjections(r))
+	t.Run("checkpoints", testCheckpoints(r))
+	t.Run("active versions", testActiveVersions(r))
+	t.Run("dead letters", testDeadLetters(r))
+	t.Run("content types", testContentTypes(r))
+	t.Run("creation time", testCreationTime(r))
+}
+
+func TestInMemoryWithAsyncDelivery(t *testing.T) {
+	r := repository.NewInMemory().WithAsyncDelivery()
+
+	t.Run("listener", testListener(r))
+	t.Run("many listeners", testManyListeners(r))
+	t.Run("several listeners on same stream", testSeveralListenersOnSameStream(r))
+	t.Run("slow listener does not block insert", func(t *testing.T) {
+		s := r.Stream("slow-stream")
+		release := make(chan struct{})
+		defer close(release)
+		listener := s.NewListener()
+		listener.Handle(func(ctx context.Context, eventID string) error {
+			<-release
+			return nil
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() { _ = listener.Listen(ctx) }()
+
+		for i := 0; i < 10; i++ {
+			_, err := s.InsertRawEvent(context.Background(), repository.RawEvent{EventType: "my_type", Version: "1", Payload: []byte("coucou")}, "")
+			require.NoError(t, err)
+		}
+	})
+	t.Run("slow listener catches up by position", func(t *testing.T) {
+		s := repository.NewInMemory().WithAsyncDelivery().Stream("lagging-stream")
+		release := make(chan struct{})
+		var received []string
+		var mutex sync.Mutex
+		listener := s.NewListener()
+		listener.Handle(func(ctx context.Context, eventID string) error {
+			<-release
+			mutex.Lock()
+			defer mutex.Unlock()
+			received = append(received, eventID)
+			return nil
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() { _ = listener.Listen(ctx) }()
+
+		// far more events than a listener queues
+		var inserted []string
+		for i := 0; i < 2505; i++ {
+			eventID, err := s.InsertRawEvent(context.Background(), repository.RawEvent{EventType: "my_type", Version: "1", Payload: []byte("coucou")}, "")
+			require.NoError(t, err)
+			inserted = append(inserted, eventID)
+		}
+		close(release)
+
+		assert.Eventually(t, func() bool {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return len(received) >= len(inserted)
+		}, time.Second, time.Millisecond)
+		mutex.Lock()
+		defer mutex.Unlock()
+		assert.Equal(t, inserted, received)
+	})
 }
 
 func testListener(r repository.Repository) func(t *testing.T) {
 	return func(t *testing.T) {
-		received := false
+		var received atomic.Bool
 		listener := r.NewListener()
 		listener.Handle(func(ctx context.Context, eventID string) error {
-			received = true
+			received.Store(true)
 			return nil
 		})
 		go func() {
 			err := listener.Listen(context.Background())
 			require.NoError(t, err)
 		}()
-
-		// give time for listener to be set-up properly
-		time.Sleep(10 * time.Millisecond)
+		<-listener.Listening()
 
 		_, err := r.InsertRawEvent(context.Background(), repository.RawEvent{EventType: "my_type", Version: "1", Payload: []byte("coucou")}, "")
 		require.NoError(t, err)
 
-		assert.Eventually(t, func() bool { return received }, time.Second, time.Millisecond)
+		assert.Eventually(t, received.Load, time.Second, time.Millisecond)
+	}
+}
+
+func testListenerOnStream(r repository.Repository, name string) func(t *testing.T) {
+	return func(t *testing.T) {
+		s := r.Stream(name)
+		var received atomic.Bool
+		listener := s.NewListener()
+		listener.Handle(func(ctx context.Context, eventID string) error {
+			event, err := s.GetRawEvent(ctx, eventID)
+			if err == nil && string(event.Payload) == name {
+				received.Store(true)
+			}
+			return err
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() { _ = listener.Listen(ctx) }()
+		<-listener.Listening()
+
+		_, err := s.InsertRawEvent(context.Background(), repository.RawEvent{EventType: "my_type", Version: "1", Payload: []byte(name)}, "")
+		require.NoError(t, err)
+
+		assert.Eventually(t, received.Load, time.Second, time.Millisecond)
+	}
+}
+
+// testListenersOnHugeStreamNames uses stream names that differ past the first 8000 bytes,
+// which do not fit in PostgreSQL notifications.
+func testListenersOnHugeStreamNames(r repository.Repository) func(t *testing.T) {
+	return func(t *testing.T) {
+		prefix := "huge-" + strings.Repeat("very-long-stream-name-", 400)
+		mine, other := r.Stream(prefix+"mine"), r.Stream(prefix+"other")
+		received := make(chan string, 2)
+		listener := mine.NewListener()
+		listener.Handle(func(ctx context.Context, eventID string) error {
+			received <- eventID
+			return nil
+		})
+		category := make(chan string, 2)
+		categoryListener := r.Stream(repository.CategoryStream("huge")).NewListener()
+		categoryListener.Handle(func(ctx context.Context, eventID string) error {
+			category <- eventID
+			return nil
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() { _ = listener.Listen(ctx) }()
+		go func() { _ = categoryListener.Listen(ctx) }()
+		<-listener.Listening()
+		<-categoryListener.Listening()
+
+		otherID, err := other.InsertRawEvent(context.Background(), repository.RawEvent{EventType: "my_type", Version: "1", Payload: []byte("other")}, "")
+		require.NoError(t, err)
+		mineID, err := mine.InsertRawEvent(context.Background(), repository.RawEvent{EventType: "my_type", Version: "1", Payload: []byte("mine")}, "")
+		require.NoError(t, err)
+
+		assert.Equal(t, mineID, <-received)
+		assert.Never(t, func() bool { return len(received) > 0 }, 50*time.Millisecond, time.Millisecond)
+		assert.Equal(t, []string{otherID, mineID}, []string{<-category, <-category})
+	}
+}
+
+func testVirtualStreams(r repository.Repository) func(t *testing.T) {
+	return func(t *testing.T) {
+		var all, category atomic.Int32
+		allStreams := r.Stream(repository.AllStreams)
+		allListener := allStreams.NewListener()
+		allListener.Handle(func(ctx context.Context, eventID string) error {
+			if event, err := allStreams.GetRawEvent(ctx, eventID); err == nil && event.EventType == "produce" {
+				all.Add(1)
+			}
+			return nil
+		})
+		categoryStream := r.Stream(repository.CategoryStream("fruit"))
+		categoryListener := categoryStream.NewListener()
+		categoryListener.Handle(func(ctx context.Context, eventID string) error {
+			if _, err := categoryStream.GetRawEvent(ctx, eventID); err == nil {
+				category.Add(1)
+			}
+			return nil
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() { _ = allListener.Listen(ctx) }()
+		go func() { _ = categoryListener.Listen(ctx) }()
+		<-allListener.Listening()
+		<-categoryListener.Listening()
+
+		_, err := r.Stream("fruit-apple").InsertRawEvent(context.Background(), repository.RawEvent{EventType: "produce", Version: "1", Payload: []byte("apple")}, "")
+		require.NoError(t, err)
+		_, err = r.Stream("fruit-pear").InsertRawEvent(context.Background(), repository.RawEvent{EventType: "produce", Version: "1", Payload: []byte("pear")}, "")
+		require.NoError(t, err)
+		_, err = r.Stream("vegetable-leek").InsertRawEvent(context.Background(), repository.RawEvent{EventType: "produce", Version: "1", Payload: []byte("leek")}, "")
+		require.NoError(t, err)
+
+		assert.Eventually(t, func() bool { return all.Load() == 3 && category.Load() == 2 }, time.Second, time.Millisecond)
+
+		events, err := categoryStream.AllRawEvents(context.Background())
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		assert.Equal(t, "fruit-apple", events[0].StreamID)
+		assert.Equal(t, "fruit-pear", events[1].StreamID)
+		assert.Less(t, events[0].Position, events[1].Position)
+
+		_, err = categoryStream.InsertRawEvent(context.Background(), repository.RawEvent{EventType: "produce", Version: "1", Payload: []byte("banana")}, "")
+		assert.ErrorIs(t, err, repository.ErrVirtualStream)
+	}
+}
+
+func testSystemStreams(r repository.Repository) func(t *testing.T) {
+	return func(t *testing.T) {
+		all := r.Stream(repository.AllStreams)
+		notified := make(chan string, 2)
+		listener := all.NewListener()
+		listener.Handle(func(ctx context.Context, eventID string) error {
+			notified <- eventID
+			return nil
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() { _ = listener.Listen(ctx) }()
+		<-listener.Listening()
+
+		_, err := r.Stream("$process-saga-k1").InsertRawEvent(context.Background(), repository.RawEvent{EventType: "saga", Version: "1", Payload: []byte("state")}, "")
+		require.NoError(t, err)
+		eventID, err := r.Stream("visible-1").InsertRawEvent(context.Background(), repository.RawEvent{EventType: "visible", Version: "1", Payload: []byte("1")}, "")
+		require.NoError(t, err)
+
+		states, err := r.Stream("$process-saga-k1").AllRawEvents(context.Background())
+		require.NoError(t, err)
+		require.Len(t, states, 1)
+		assert.Equal(t, []byte("state"), states[0].Payload)
+		raws, err := all.AllRawEvents(context.Background())
+		require.NoError(t, err)
+		for _, raw := range raws {
+			assert.False(t, repository.IsSystemStream(raw.StreamID), raw.StreamID)
+		}
+		head, err := all.HeadPosition(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, raws[len(raws)-1].Position, head)
+		assert.Equal(t, eventID, <-notified)
+		assert.Never(t, func() bool { return len(notified) > 0 }, 50*time.Millisecond, time.Millisecond)
+	}
+}
+
+func testCategoriesHoldingDashes(r repository.Repository) func(t *testing.T) {
+	return func(t *testing.T) {
+		accounts := r.Stream(repository.CategoryStream("bank-account"))
+		var notified atomic.Int32
+		listener := accounts.NewListener()
+		listener.Handle(func(ctx context.Context, eventID string) error {
+			notified.Add(1)
+			return nil
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() { _ = listener.Listen(ctx) }()
+		<-listener.Listening()
+
+		_, err := r.Stream("bank-account-42").InsertRawEvent(context.Background(), repository.RawEvent{EventType: "opened", Version: "1", Payload: []byte("42")}, "")
+		require.NoError(t, err)
+		_, err = r.Stream("bank-transfer-7").InsertRawEvent(context.Background(), repository.RawEvent{EventType: "sent", Version: "1", Payload: []byte("7")}, "")
+		require.NoError(t, err)
+
+		raws, err := accounts.AllRawEvents(context.Background())
+		require.NoError(t, err)
+		require.Len(t, raws, 1)
+		assert.Equal(t, "bank-account-42", raws[0].StreamID)
+		bank, err := r.Stream(repository.CategoryStream("bank")).AllRawEvents(context.Background())
+		require.NoError(t, err)
+		assert.Len(t, bank, 2)
+		assert.Eventually(t, func() bool { return notified.Load() == 1 }, time.Second, time.Millisecond)
+		assert.Never(t, func() bool { return notified.Load() > 1 }, 50*time.Millisecond, time.Millisecond)
+	}
+}
+
+func testInlineProjections(r repository.Repository) func(t *testing.T) {
+	return func(t *testing.T) {
+		var projected []repository.RawEvent
+		remove := r.(repository.InlineProjector).AddInlineProjection(func(ctx context.Context, tx repository.Tx, raw *repository.RawEvent) error {
+			if !strings.HasPrefix(raw.StreamID, "inline-") {
+				return nil
+			}
+			if raw.EventType == "rejected" {
+				return errors.New("projection failed")
+			}
+			projected = append(projected, *raw)
+			return nil
+		})
+		s := r.Stream("inline-projected")
+
+		eventId, err := s.InsertRawEvent(context.Background(), repository.RawEvent{EventType: "accepted", Version: "1", Payload: []byte("one")}, "")
+		require.NoError(t, err)
+		require.Len(t, projected, 1)
+		assert.Equal(t, eventId, projected[0].EventID)
+		assert.Equal(t, "inline-projected", projected[0].StreamID)
+		assert.NotZero(t, projected[0].Position)
+
+		_, err = s.InsertRawEvent(context.Background(), repository.RawEvent{EventType: "rejected", Version: "2", Payload: []byte("two")}, "")
+		assert.Error(t, err)
+
+		events, err := s.AllRawEvents(context.Background())
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, eventId, events[0].EventID)
+
+		remove()
+		_, err = s.InsertRawEvent(context.Background(), repository.RawEvent{EventType: "rejected", Version: "3", Payload: []byte("three")}, "")
+		require.NoError(t, err)
+		assert.Len(t, projected, 1)
+	}
+}
+
+func testInlineProjectionTransaction(r repository.Repository, connectionString string) func(t *testing.T) {
+	return func(t *testing.T) {
+		conn, err := pgx.Connect(context.Background(), connectionString)
+		require.NoError(t, err)
+		defer conn.Close(context.Background())
+		_, err = conn.Exec(context.Background(), "create table if not exists projected_payloads (event_id text, payload text)")
+		require.NoError(t, err)
+
+		remove := r.(repository.InlineProjector).AddInlineProjection(func(ctx context.Context, tx repository.Tx, raw *repository.RawEvent) error {
+			if raw.StreamID != "transactional-projection" {
+				return nil
+			}
+			_, err := tx.(pgx.Tx).Exec(ctx, "insert into projected_payloads (event_id, payload) values ($1, $2)", raw.EventID, string(raw.Payload))
+			if err != nil || raw.EventType == "rejected" {
+				return errors.Join(err, errors.New("projection failed"))
+			}
+			return nil
+		})
+		defer remove()
+		s := r.Stream("transactional-projection")
+
+		eventId, err := s.InsertRawEvent(context.Background(), repository.RawEvent{EventType: "accepted", Version: "1", Payload: []byte("kept")}, "")
+		require.NoError(t, err)
+		_, err = s.InsertRawEvent(context.Background(), repository.RawEvent{EventType: "rejected", Version: "2", Payload: []byte("rolled back")}, "")
+		require.Error(t, err)
+
+		rows, err := conn.Query(context.Background(), "select event_id from projected_payloads")
+		require.NoError(t, err)
+		projected, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		require.NoError(t, err)
+		assert.Equal(t, []string{eventId}, projected)
+
+		events, err := s.AllRawEvents(context.Background())
+		require.NoError(t, err)
+		assert.Len(t, events, 1)
+	}
+}
+
+func testListenerCatchesUpAfterReconnecting(r repository.Repository, connectionString string) func(t *testing.T) {
+	return func(t *testing.T) {
+		s := r.Stream("reconnecting-listener")
+		var received atomic.Int32
+		listener := s.NewListener()
+		listener.Handle(func(ctx context.Context, eventID string) error {
+			received.Add(1)
+			return nil
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() { _ = listener.Listen(ctx) }()
+		<-listener.Listening()
+
+		conn, err := pgx.Connect(context.Background(), connectionString)
+		require.NoError(t, err)
+		defer conn.Close(context.Background())
+		_, err = conn.Exec(context.Background(), "select pg_terminate_backend(pid) from pg_stat_activity where query ilike 'listen %'")
+		require.NoError(t, err)
+
+		// notified to no one, until LISTEN is in effect again
+		for i := 0; i < 3; i++ {
+			_, err := s.InsertRawEvent(context.Background(), repository.RawEvent{EventType: "my_type", Version: "1", Payload: []byte("coucou")}, "")
+			require.NoError(t, err)
+		}
+
+		assert.Eventually(t, func() bool { return received.Load() == 3 }, 5*time.Second, 10*time.Millisecond)
+		assert.Never(t, func() bool { return received.Load() > 3 }, 100*time.Millisecond, 10*time.Millisecond)
+	}
+}
+
+func testListeningFailsWithoutNotifications(connectionString string) func(t *testing.T) {
+	return func(t *testing.T) {
+		ctx := context.Background()
+		conn, err := pgx.Connect(ctx, connectionString)
+		require.NoError(t, err)
+		defer conn.Close(ctx)
+		// a single connection for the role, taken by the pool
+		_, err = conn.Exec(ctx, "drop role if exists single_connection")
+		require.NoError(t, err)
+		_, err = conn.Exec(ctx, "create role single_connection login password 'single' connection limit 1 in role "+pgx.Identifier{postgresContainer.user}.Sanitize())
+		require.NoError(t, err)
+		pg, err := repository.NewPostgres(ctx, strings.Replace(connectionString, postgresContainer.user+":"+postgresContainer.password, "single_connection:single", 1)+"&pool_max_conns=1")
+		require.NoError(t, err)
+		defer pg.Close()
+
+		listener := pg.Stream("without-notifications").NewListener()
+		listener.Handle(func(ctx context.Context, eventID string) error { return nil })
+		listenCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		err = listener.Listen(listenCtx)
+
+		assert.ErrorContains(t, err, "connect")
+		assert.NoError(t, listenCtx.Err(), "Listen returned before its context was done")
+	}
+}
+
+func testVirtualStreamsWaitForConcurrentAppends(r repository.Repository) func(t *testing.T) {
+	return func(t *testing.T) {
+		inserting, release := make(chan struct{}), make(chan struct{})
+		remove := r.(repository.InlineProjector).AddInlineProjection(func(ctx context.Context, tx repository.Tx, raw *repository.RawEvent) error {
+			if raw.StreamID == "ordered-slow" {
+				close(inserting)
+				<-release
+			}
+			return nil
+		})
+		defer remove()
+		slow := make(chan error, 1)
+		go func() {
+			_, err := r.Stream("ordered-slow").InsertRawEvent(context.Background(), repository.RawEvent{EventType: "slow"}, "")
+			slow <- err
+		}()
+		<-inserting
+		_, err := r.Stream("ordered-fast").InsertRawEvent(context.Background(), repository.RawEvent{EventType: "fast"}, "")
+		require.NoError(t, err)
+
+		category := r.Stream(repository.CategoryStream("ordered"))
+		events, err := category.ReadRawEvents(context.Background(), 0, 0)
+		require.NoError(t, err)
+		assert.Empty(t, events)
+		head, err := category.HeadPosition(context.Background())
+		require.NoError(t, err)
+		assert.Zero(t, head)
+
+		close(release)
+		require.NoError(t, <-slow)
+		events, err = category.ReadRawEvents(context.Background(), 0, 0)
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		assert.Equal(t, "slow", events[0].EventType)
+		assert.Equal(t, "fast", events[1].EventType)
+	}
+}
+
+func testCreationTime(r repository.Repository) func(t *testing.T) {
+	return func(t *testing.T) {
+		s := r.Stream("timed")
+		eventId, err := s.InsertRawEvent(context.Background(), repository.RawEvent{EventType: "timed"}, "")
+		require.NoError(t, err)
+
+		raw, err := s.GetRawEvent(context.Background(), eventId)
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now(), raw.CreatedAt, time.Minute)
+	}
+}
+
+func testContentTypes(r repository.Repository) func(t *testing.T) {
+	return func(t *testing.T) {
+		stream := r.Stream("content-typed")
+		_, err := stream.InsertRawEvent(context.Background(), repository.RawEvent{EventType: "typed", ContentType: "application/json", Payload: []byte("{}")}, "")
+		require.NoError(t, err)
+		_, err = stream.InsertRawEvent(context.Background(), repository.RawEvent{EventType: "untyped", Payload: []byte("untyped")}, "")
+		require.NoError(t, err)
+
+		raws, err := stream.AllRawEvents(context.Background())
+		require.NoError(t, err)
+		require.Len(t, raws, 2)
+		assert.Equal(t, "application/json", raws[0].ContentType)
+		assert.Empty(t, raws[1].ContentType)
+		raw, err := stream.GetRawEvent(context.Background(), raws[0].EventID)
+		require.NoError(t, err)
+		assert.Equal(t, "application/json", raw.ContentType)
+	}
+}
+
+func testJSONBPayloads(pg *repository.Postgres) func(t *testing.T) {
+	return func(t *testing.T) {
+		ctx := context.Background()
+		require.NoError(t, pg.CreateJSONBIndex(ctx))
+		stream := pg.WithJSONBPayloads().Stream("jsonb-payments")
+		for _, payload := range []string{`{"Amount": 500, "Currency": "EUR"}`, `{"Amount": 1500, "Currency": "EUR"}`, `{"Amount": 2500, "Currency": "USD"}`} {
+			_, err := stream.InsertRawEvent(ctx, repository.RawEvent{ContentType: "application/json", Payload: []byte(payload)}, "")
+			require.NoError(t, err)
+		}
+		_, err := stream.InsertRawEvent(ctx, repository.RawEvent{ContentType: "application/json", Payload: []byte("not json")}, "")
+		require.NoError(t, err)
+		_, err = stream.InsertRawEvent(ctx, repository.RawEvent{ContentType: "application/json", Payload: []byte(`{"Amount": 3500, "Reference": "\u0000"}`)}, "")
+		require.NoError(t, err)
+
+		raws, err := stream.(repository.JSONQuerier).QueryRawEvents(ctx, "$.Amount > 1000", 0, 0)
+		require.NoError(t, err)
+		require.Len(t, raws, 2)
+		assert.JSONEq(t, `{"Amount": 1500, "Currency": "EUR"}`, string(raws[0].Payload))
+		assert.JSONEq(t, `{"Amount": 2500, "Currency": "USD"}`, string(raws[1].Payload))
+
+		raws, err = stream.(repository.JSONQuerier).QueryRawEvents(ctx, `$.Currency == "EUR"`, raws[0].Position, 1)
+		require.NoError(t, err)
+		require.Len(t, raws, 1)
+		assert.JSONEq(t, `{"Amount": 1500, "Currency": "EUR"}`, string(raws[0].Payload))
+
+		raws, err = stream.AllRawEvents(ctx)
+		require.NoError(t, err)
+		require.Len(t, raws, 5)
+		assert.JSONEq(t, `{"Amount": 500, "Currency": "EUR"}`, string(raws[0].Payload))
+		assert.Equal(t, "not json", string(raws[3].Payload))
+		assert.Equal(t, `{"Amount": 3500, "Reference": "\u0000"}`, string(raws[4].Payload))
+	}
+}
+
+func testCheckpoints(store repository.CheckpointStore) func(t *testing.T) {
+	return func(t *testing.T) {
+		position, err := store.LoadCheckpoint(context.Background(), "checkpointed")
+		require.NoError(t, err)
+		assert.Zero(t, position)
+
+		require.NoError(t, store.SaveCheckpoint(context.Background(), "checkpointed", 10, func(tx repository.Tx) error { return nil }))
+		err = store.SaveCheckpoint(context.Background(), "checkpointed", 20, func(tx repository.Tx) error { return errors.New("projection failed") })
+		require.Error(t, err)
+
+		position, err = store.LoadCheckpoint(context.Background(), "checkpointed")
+		require.NoError(t, err)
+		assert.Equal(t, int64(10), position)
+	}
+}
+
+func testActiveVersions(store repository.CheckpointStore) func(t *testing.T) {
+	return func(t *testing.T) {
+		version, err := store.LoadActiveVersion(context.Background(), "versioned")
+		require.NoError(t, err)
+		assert.Zero(t, version)
+
+		require.NoError(t, store.SaveCheckpoint(context.Background(), "versioned", 10, func(tx repository.Tx) error { return nil }))
+		require.NoError(t, store.SaveActiveVersion(context.Background(), "versioned", 2))
+		require.NoError(t, store.SaveActiveVersion(context.Background(), "versioned", 3))
+
+		version, err = store.LoadActiveVersion(context.Background(), "versioned")
+		require.NoError(t, err)
+		assert.Equal(t, 3, version)
+		position, err := store.LoadCheckpoint(context.Background(), "versioned")
+		require.NoError(t, err)
+		assert.Equal(t, int64(10), position)
+	}
+}
+
+func testDeadLetters(store repository.CheckpointStore) func(t *testing.T) {
+	return func(t *testing.T) {
+		letters, err := store.DeadLetters(context.Background(), "dead-lettering")
+		require.NoError(t, err)
+		assert.Empty(t, letters)
+
+		require.NoError(t, store.SaveCheckpoint(context.Background(), "dead-lettering", 2, func(tx repository.Tx) error {
+			return store.SaveDeadLetter(context.Background(), tx, repository.DeadLetter{Name: "dead-lettering", Position: 2, EventID: "e2", Error: "poison"})
+		}))
+
+		letters, err = store.DeadLetters(context.Background(), "dead-lettering")
+		require.NoError(t, err)
+		require.Len(t, letters, 1)
+		assert.Equal(t, int64(2), letters[0].Position)
+		assert.Equal(t, "e2", letters[0].EventID)
+		assert.Equal(t, "poison", letters[0].Error)
+	}
+}
+
+func testSnapshots(store repository.SnapshotStore) func(t *testing.T) {
+	return func(t *testing.T) {
+		_, err := store.LatestSnapshot(context.Background(), "snapshotted-stream")
+		require.ErrorIs(t, err, repository.ErrSnapshotNotFound)
+
+		require.NoError(t, store.SaveSnapshot(context.Background(), repository.RawSnapshot{StreamID: "snapshotted-stream", Revision: "a", Position: 10, Payload: []byte("ten")}))
+		require.NoError(t, store.SaveSnapshot(context.Background(), repository.RawSnapshot{StreamID: "snapshotted-stream", Revision: "b", Position: 20, Payload: []byte("twenty")}))
+		require.NoError(t, store.SaveSnapshot(context.Background(), repository.RawSnapshot{StreamID: "other-stream", Revision: "c", Position: 30, Payload: []byte("thirty")}))
+
+		snapshot, err := store.LatestSnapshot(context.Background(), "snapshotted-stream")
+		require.NoError(t, err)
+		assert.Equal(t, "b", snapshot.Revision)
+		assert.Equal(t, int64(20), snapshot.Position)
+		assert.Equal(t, []byte("twenty"), snapshot.Payload)
+
+		require.NoError(t, store.SaveSnapshot(context.Background(), repository.RawSnapshot{StreamID: "snapshotted-stream", Revision: "a", Position: 10, Payload: []byte("ten")}))
+		snapshot, err = store.LatestSnapshot(context.Background(), "snapshotted-stream")
+		require.NoError(t, err)
+		assert.Equal(t, "b", snapshot.Revision)
+
+		require.NoError(t, store.SaveSnapshot(context.Background(), repository.RawSnapshot{StreamID: "snapshotted-stream", Revision: "a", Position: 10, SchemaVersion: 2, Payload: []byte("ten, version 2")}))
+		snapshot, err = store.LatestSnapshot(context.Background(), "snapshotted-stream")
+		require.NoError(t, err)
+		assert.Equal(t, 2, snapshot.SchemaVersion)
+		assert.Equal(t, []byte("ten, version 2"), snapshot.Payload)
+	}
+}
+
+func testSeveralListenersOnSameStream(r repository.Repository) func(t *testing.T) {
+	return func(t *testing.T) {
+		s := r.Stream("several-listeners")
+		var first, second atomic.Int32
+		firstListener := s.NewListener()
+		firstListener.Handle(func(ctx context.Context, eventID string) error {
+			first.Add(1)
+			return nil
+		})
+		secondListener := s.NewListener()
+		secondListener.Handle(func(ctx context.Context, eventID string) error {
+			second.Add(1)
+			return nil
+		})
+		firstCtx, cancelFirst := context.WithCancel(context.Background())
+		secondCtx, cancelSecond := context.WithCancel(context.Background())
+		defer cancelSecond()
+		firstDone := make(chan struct{})
+		go func() { _ = firstListener.Listen(firstCtx); close(firstDone) }()
+		go func() { _ = secondListener.Listen(secondCtx) }()
+		<-firstListener.Listening()
+		<-secondListener.Listening()
+
+		_, err := s.InsertRawEvent(context.Background(), repository.RawEvent{EventType: "my_type", Version: "1", Payload: []byte("coucou")}, "")
+		require.NoError(t, err)
+		assert.Eventually(t, func() bool { return first.Load() == 1 && second.Load() == 1 }, time.Second, time.Millisecond)
+
+		cancelFirst()
+		<-firstDone
+		_, err = s.InsertRawEvent(context.Background(), repository.RawEvent{EventType: "my_type", Version: "1", Payload: []byte("salut")}, "")
+		require.NoError(t, err)
+		assert.Eventually(t, func() bool { return second.Load() == 2 }, time.Second, time.Millisecond)
+		assert.Equal(t, int32(1), first.Load())
+	}
+}
+
+func testManyListeners(r repository.Repository) func(t *testing.T) {
+	return func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var received atomic.Int32
+		streamCount := 50
+		for i := 0; i < streamCount; i++ {
+			listener := r.Stream(fmt.Sprintf("many-listeners-%d", i)).NewListener()
+			listener.Handle(func(ctx context.Context, eventID string) error {
+				received.Add(1)
+				return nil
+			})
+			go func() { _ = listener.Listen(ctx) }()
+			<-listener.Listening()
+		}
+
+		for i := 0; i < streamCount; i++ {
+			_, err := r.Stream(fmt.Sprintf("many-listeners-%d", i)).InsertRawEvent(context.Background(), repository.RawEvent{EventType: "my_type", Version: "1", Payload: []byte("coucou")}, "")
+			require.NoError(t, err)
+		}
+
+		assert.Eventually(t, func() bool { return received.Load() == int32(streamCount) }, 5*time.Second, time.Millisecond)
 	}
 }
 
@@ -88,6 +750,62 @@ func testInsertWithExpectedVersion(r repository.Repository) func(t *testing.T) {
 	}
 }
 
+func testInsertWithOutdatedExpectedVersion(r repository.Repository) func(t *testing.T) {
+	return func(t *testing.T) {
+		s := r.Stream("outdated")
+		_, err := s.InsertRawEvent(context.Background(), repository.RawEvent{EventType: "my_type", Version: "1", Payload: []byte("coucou")}, "")
+		require.NoError(t, err)
+		_, err = s.InsertRawEvent(context.Background(), repository.RawEvent{EventType: "my_type", Version: "2", Payload: []byte("salut")}, "1")
+		require.NoError(t, err)
+
+		_, err = s.InsertRawEvent(context.Background(), repository.RawEvent{EventType: "my_type", Version: "3", Payload: []byte("hello")}, "1")
+		assert.ErrorIs(t, err, repository.ErrVersionMismatch)
+	}
+}
+
+func testInsertWithNoStreamExpected(r repository.Repository) func(t *testing.T) {
+	return func(t *testing.T) {
+		s := r.Stream("no-stream")
+		_, err := s.InsertRawEvent(context.Background(), repository.RawEvent{EventType: "my_type", Version: "1", Payload: []byte("coucou")}, repository.NoStream)
+		require.NoError(t, err)
+
+		_, err = s.InsertRawEvent(context.Background(), repository.RawEvent{EventType: "my_type", Version: "2", Payload: []byte("salut")}, repository.NoStream)
+		assert.ErrorIs(t, err, repository.ErrVersionMismatch)
+	}
+}
+
+func testInsertWithExpectedVersionOnEmptyStream(r repository.Repository) func(t *testing.T) {
+	return func(t *testing.T) {
+		_, err := r.Stream("empty-expected").InsertRawEvent(context.Background(), repository.RawEvent{EventType: "my_type", Version: "1", Payload: []byte("coucou")}, "1")
+		assert.ErrorIs(t, err, repository.ErrVersionMismatch)
+	}
+}
+
+func testInsertRawEvents(r repository.Repository) func(t *testing.T) {
+	return func(t *testing.T) {
+		s := r.Stream("batch")
+		inserted, err := s.InsertRawEvents(context.Background(), []repository.RawEvent{
+			{EventType: "my_type", Version: "1", Payload: []byte("coucou")},
+			{EventType: "my_type", Version: "2", Payload: []byte("salut")},
+		}, repository.NoStream)
+		require.NoError(t, err)
+		require.Len(t, inserted, 2)
+		assert.Equal(t, "batch", inserted[1].StreamID)
+		assert.Greater(t, inserted[1].Position, inserted[0].Position)
+
+		_, err = s.InsertRawEvents(context.Background(), []repository.RawEvent{
+			{EventType: "my_type", Version: "3", Payload: []byte("hello")},
+			{EventType: "my_type", Version: "4", Payload: []byte("hi")},
+		}, "1")
+		assert.ErrorIs(t, err, repository.ErrVersionMismatch)
+
+		raws, err := s.AllRawEvents(context.Background())
+		require.NoError(t, err)
+		require.Len(t, raws, 2)
+		assert.Equal(t, "2", raws[1].Version)
+	}
+}
+
 func testInsertWithUnexpectedVeresion(r repository.Repository) func(t *testing.T) {
 	return func(t *testing.T) {
 		_, err := r.InsertRawEvent(context.Background(), repository.RawEvent{EventType: "my_type", Version: "1", Payload: []byte("coucou")}, "bad")
@@ -2,31 +2,89 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/nbarbey/go-event-store/eventstore/codec"
 	"github.com/nbarbey/go-event-store/eventstore/consumer"
+	"maps"
 )
 
+var ErrUnknownContentType = errors.New("no codec for content type")
+
+// DecodeError tells which event of a page could not be decoded, for readers to get past it.
+type DecodeError struct {
+	EventID  string
+	Position int64
+	Err      error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decoding event %s at position %d: %s", e.EventID, e.Position, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// TypedRepository writes events with its codec and records its content type, then reads
+// each event with the codec of its content type: codecs replaced by WithCodec are kept
+// for reading, so that a store can move from one codec to another without rewriting its
+// events. Events stored without content type are read as the content type of the first
+// codec, unless told otherwise by AssumeContentType.
 type TypedRepository[E any] struct {
 	Repository
-	codec *codec.Versioned[E]
+	// streamId is the stream told to codecs encoding events, empty until Stream is called
+	streamId    string
+	codec       *codec.Versioned[E]
+	contentType string
+	// readers is replaced rather than updated, as it is shared with the streams of the repository
+	readers map[string]*codec.Versioned[E]
+	assumed string
 }
 
 func NewTypedRepository[E any](repo Repository, c codec.TypedCodec[E]) *TypedRepository[E] {
-	return &TypedRepository[E]{
+	contentType := codec.ContentTypeOf(c)
+	tr := &TypedRepository[E]{
 		Repository: repo,
-		codec:      &codec.Versioned[E]{TypedCodec: c},
+		assumed:    contentType,
 	}
+	return tr.WithCodec(c)
 }
 
 func (tr *TypedRepository[E]) WithCodec(c codec.TypedCodec[E]) *TypedRepository[E] {
 	tr.codec = &codec.Versioned[E]{TypedCodec: c}
+	tr.contentType = codec.ContentTypeOf(c)
+	tr.AddCodec(c)
+	return tr
+}
+
+// AddCodec reads events of the content type of c with c, without writing with it.
+func (tr *TypedRepository[E]) AddCodec(c codec.TypedCodec[E]) *TypedRepository[E] {
+	if contentType := codec.ContentTypeOf(c); contentType != "" {
+		readers := maps.Clone(tr.readers)
+		if readers == nil {
+			readers = make(map[string]*codec.Versioned[E])
+		}
+		readers[contentType] = &codec.Versioned[E]{TypedCodec: c}
+		tr.readers = readers
+	}
+	return tr
+}
+
+// AssumeContentType reads events stored without content type as contentType.
+func (tr *TypedRepository[E]) AssumeContentType(contentType string) *TypedRepository[E] {
+	tr.assumed = contentType
 	return tr
 }
 
 func (tr *TypedRepository[E]) Stream(name string) *TypedRepository[E] {
 	return &TypedRepository[E]{
-		Repository: tr.Repository.Stream(name),
-		codec:      tr.codec,
+		Repository:  tr.Repository.Stream(name),
+		streamId:    name,
+		codec:       tr.codec,
+		contentType: tr.contentType,
+		readers:     tr.readers,
+		assumed:     tr.assumed,
 	}
 }
 
@@ -50,42 +108,230 @@ func (tr *TypedRepository[E]) All(ctx context.Context) ([]E, error) {
 	return tr.rawsToEvents(raws)
 }
 
+func (tr *TypedRepository[E]) ReadEnvelopes(ctx context.Context, fromPosition int64, limit int) ([]Envelope[E], error) {
+	envelopes, _, err := tr.ReadEnvelopePage(ctx, fromPosition, limit)
+	return envelopes, err
+}
+
+// ReadEnvelopePage also returns the position of the last event read, skipped events
+// included, for the next page to start after it. An event that cannot be decoded ends the
+// page with a DecodeError, after the events before it.
+func (tr *TypedRepository[E]) ReadEnvelopePage(ctx context.Context, fromPosition int64, limit int) (envelopes []Envelope[E], lastPosition int64, err error) {
+	raws, err := tr.ReadRawEvents(ctx, fromPosition, limit)
+	if err != nil {
+		return nil, fromPosition - 1, err
+	}
+	return tr.rawsToEnvelopes(raws, fromPosition)
+}
+
+// QueryEnvelopes reads the events whose JSON payload matches predicate, a SQL/JSON path
+// predicate such as `$.Amount > 1000`, when the repository is a JSONQuerier.
+func (tr *TypedRepository[E]) QueryEnvelopes(ctx context.Context, predicate string, fromPosition int64, limit int) ([]Envelope[E], error) {
+	querier, ok := tr.Repository.(JSONQuerier)
+	if !ok {
+		return nil, ErrJSONQueryNotSupported
+	}
+	raws, err := querier.QueryRawEvents(ctx, predicate, fromPosition, limit)
+	if err != nil {
+		return nil, err
+	}
+	envelopes, _, err := tr.rawsToEnvelopes(raws, fromPosition)
+	return envelopes, err
+}
+
+func (tr *TypedRepository[E]) rawsToEnvelopes(raws []*RawEvent, fromPosition int64) (envelopes []Envelope[E], lastPosition int64, err error) {
+	lastPosition = fromPosition - 1
+	envelopes = make([]Envelope[E], 0, len(raws))
+	for _, raw := range raws {
+		envelope, err := tr.rawToEnvelope(raw)
+		if errors.Is(err, ErrEventSkipped) {
+			lastPosition = raw.Position
+			continue
+		}
+		if err != nil {
+			return envelopes, lastPosition, &DecodeError{EventID: raw.EventID, Position: raw.Position, Err: err}
+		}
+		envelopes = append(envelopes, envelope)
+		lastPosition = raw.Position
+	}
+	return envelopes, lastPosition, nil
+}
+
 func (tr *TypedRepository[E]) InsertEvent(ctx context.Context, version, typeHint string, event E, expectedVersion string) error {
-	data, err := tr.codec.Marshall(event)
+	raw, err := tr.eventToRaw(PendingEvent[E]{Version: version, TypeHint: typeHint, Event: event})
 	if err != nil {
 		return err
 	}
-	_, err = tr.InsertRawEvent(ctx, RawEvent{EventType: typeHint, Version: version, Payload: data}, expectedVersion)
+	_, err = tr.InsertRawEvent(ctx, raw, expectedVersion)
 	return err
 }
 
+type PendingEvent[E any] struct {
+	Version  string
+	TypeHint string
+	Event    E
+}
+
+// InsertEvents appends all the events or none of them, see Repository.InsertRawEvents.
+func (tr *TypedRepository[E]) InsertEvents(ctx context.Context, events []PendingEvent[E], expectedVersion string) ([]*RawEvent, error) {
+	raws := make([]RawEvent, 0, len(events))
+	for _, event := range events {
+		raw, err := tr.eventToRaw(event)
+		if err != nil {
+			return nil, err
+		}
+		raws = append(raws, raw)
+	}
+	return tr.InsertRawEvents(ctx, raws, expectedVersion)
+}
+
+func (tr *TypedRepository[E]) eventToRaw(event PendingEvent[E]) (RawEvent, error) {
+	typeHint := event.TypeHint
+	if typeHint == "" {
+		typeHint = tr.registeredTypeHint(event.Event)
+	}
+	data, err := codec.MarshallToStream[E](tr.codec.TypedCodec, tr.streamId, event.Event)
+	if err != nil {
+		return RawEvent{}, err
+	}
+	return RawEvent{EventType: typeHint, Version: event.Version, ContentType: tr.contentType, Payload: data}, nil
+}
+
+// registeredTypeHint is the name event is registered under, or the codec names it, at the
+// current schema version of the codec when it versions type hints, lest current events be
+// upcast again on read.
+func (tr *TypedRepository[E]) registeredTypeHint(event E) string {
+	name := codec.TypeHintOf(event)
+	if name == "" {
+		name = codec.EventTypeHintOf(tr.codec.TypedCodec, event)
+	}
+	if hinter, ok := tr.codec.TypedCodec.(codec.TypeHinter); ok && name != "" {
+		return hinter.TypeHint(name)
+	}
+	return name
+}
+
+func (tr *TypedRepository[E]) GetEnvelope(ctx context.Context, eventId string) (envelope Envelope[E], err error) {
+	raw, err := tr.GetRawEvent(ctx, eventId)
+	if err != nil {
+		return
+	}
+	return tr.rawToEnvelope(raw)
+}
+
 func (tr *TypedRepository[E]) BuildListener(consumer consumer.Consumer[E]) Listener {
+	return tr.BuildEnvelopeListener(func(ctx context.Context, envelope Envelope[E]) error {
+		consumer.Consume(envelope.Event)
+		return nil
+	})
+}
+
+func (tr *TypedRepository[E]) BuildEnvelopeListener(h func(ctx context.Context, envelope Envelope[E]) error) Listener {
 	listener := tr.NewListener()
 
 	listener.Handle(func(ctx context.Context, eventId string) error {
-		event, err := tr.GetEvent(ctx, eventId)
+		envelope, err := tr.GetEnvelope(ctx, eventId)
+		if errors.Is(err, ErrEventSkipped) {
+			return nil
+		}
 		if err != nil {
 			return err
 		}
 
-		consumer.Consume(event)
-		return nil
+		return h(ctx, envelope)
 	})
 	return listener
 }
 
+// AddInlineProjection runs h on the events appended to any stream of the repository, when
+// it is an InlineProjector, until remove is called.
+func (tr *TypedRepository[E]) AddInlineProjection(h func(ctx context.Context, tx Tx, envelope Envelope[E]) error) (remove func(), err error) {
+	projector, ok := tr.Repository.(InlineProjector)
+	if !ok {
+		return nil, ErrInlineProjectionsNotSupported
+	}
+	return projector.AddInlineProjection(func(ctx context.Context, tx Tx, raw *RawEvent) error {
+		envelope, err := tr.rawToEnvelope(raw)
+		if errors.Is(err, ErrEventSkipped) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return h(ctx, tx, envelope)
+	}), nil
+}
+
+func (tr *TypedRepository[E]) rawToEnvelope(raw *RawEvent) (envelope Envelope[E], err error) {
+	event, unknown, err := tr.decode(raw)
+	return Envelope[E]{
+		EventID:   raw.EventID,
+		StreamID:  raw.StreamID,
+		Position:  raw.Position,
+		EventType: raw.EventType,
+		Version:   raw.Version,
+		CreatedAt: raw.CreatedAt,
+		Event:     event,
+		Unknown:   unknown,
+	}, err
+}
+
 func (tr *TypedRepository[E]) rawToEvent(raw *RawEvent) (event E, err error) {
-	event, err = tr.codec.UnmarshallWithType(raw.EventType, raw.Payload)
+	event, _, err = tr.decode(raw)
+	return event, err
+}
+
+func (tr *TypedRepository[E]) decode(raw *RawEvent) (event E, unknown *codec.UnknownEvent, err error) {
+	reader, err := tr.reader(raw.ContentType)
+	if err != nil {
+		return event, nil, err
+	}
+	event, err = reader.UnmarshallWithType(raw.EventType, raw.Payload)
+	if errors.Is(err, codec.ErrSubjectForgotten) {
+		return event, nil, ErrEventSkipped
+	}
+	var unknownType *codec.UnknownEventTypeError
+	if errors.As(err, &unknownType) {
+		switch unknownType.Policy {
+		case codec.SkipUnknownTypes:
+			return event, nil, ErrEventSkipped
+		case codec.KeepUnknownTypesRaw:
+			// never a zero event: unknown events are skipped unless E can hold them
+			event, ok := any(unknownType.UnknownEvent).(E)
+			if !ok {
+				return event, nil, ErrEventSkipped
+			}
+			return event, &unknownType.UnknownEvent, nil
+		}
+	}
 	versioned, ok := any(&event).(VersionSetter)
 	if ok {
 		versioned.SetVersion(raw.Version)
 	}
-	return event, err
+	return event, nil, err
+}
+
+func (tr *TypedRepository[E]) reader(contentType string) (*codec.Versioned[E], error) {
+	// a codec without content type reads its own events, which have none either
+	if contentType == "" && tr.contentType != "" {
+		contentType = tr.assumed
+	}
+	if contentType == "" || contentType == tr.contentType {
+		return tr.codec, nil
+	}
+	reader, ok := tr.readers[contentType]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownContentType, contentType)
+	}
+	return reader, nil
 }
 
 func (tr *TypedRepository[E]) rawsToEvents(raws []*RawEvent) (events []E, err error) {
 	for _, raw := range raws {
 		event, err := tr.rawToEvent(raw)
+		if errors.Is(err, ErrEventSkipped) {
+			continue
+		}
 		if err != nil {
 			return events, err
 		}
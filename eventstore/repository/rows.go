@@ -1,20 +1,31 @@
 package repository
 
-import "database/sql"
+import (
+	"database/sql"
+	"time"
+)
 
 type eventRow struct {
-	EventID   string
-	EventType sql.NullString
-	Version   sql.NullString
-	StreamID  sql.NullString
-	Payload   []byte
+	EventID     string
+	EventType   sql.NullString
+	Version     sql.NullString
+	ContentType sql.NullString
+	StreamID    sql.NullString
+	Payload     []byte
+	Position    int64
+	CreatedAt   time.Time
 }
 
 func (er *eventRow) ToRawEvent() *RawEvent {
 	return &RawEvent{
-		EventType: er.EventType.String,
-		Version:   er.Version.String,
-		Payload:   er.Payload,
+		EventID:     er.EventID,
+		StreamID:    er.StreamID.String,
+		Position:    er.Position,
+		EventType:   er.EventType.String,
+		Version:     er.Version.String,
+		ContentType: er.ContentType.String,
+		Payload:     er.Payload,
+		CreatedAt:   er.CreatedAt,
 	}
 }
 
@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+type RawSnapshot struct {
+	StreamID string
+	Revision string
+	Position int64
+	// SchemaVersion is the version of the state the payload holds.
+	SchemaVersion int
+	Payload       []byte
+	CreatedAt     time.Time
+}
+
+// SnapshotStore keeps the latest snapshot of each stream only. A snapshot replaces it unless
+// it is of the same schema version and at a later position.
+type SnapshotStore interface {
+	SaveSnapshot(ctx context.Context, snapshot RawSnapshot) error
+	LatestSnapshot(ctx context.Context, streamId string) (*RawSnapshot, error)
+}
+
+var ErrSnapshotNotFound = errors.New("snapshot not found")
@@ -0,0 +1,56 @@
+package repository
+
+import "strings"
+
+// AllStreams and category streams are virtual: they can be read and listened to, but
+// not appended to.
+const AllStreams = "$all"
+
+const categoryPrefix = "$ce-"
+
+// CategoryStream holds the streams whose name starts with category and "-": the category
+// may hold "-" itself, so that "bank-account-42" belongs to both "bank" and "bank-account".
+func CategoryStream(category string) string {
+	return categoryPrefix + category
+}
+
+// StreamCategory is the shortest category streamId belongs to.
+func StreamCategory(streamId string) string {
+	category, _, _ := strings.Cut(streamId, "-")
+	return category
+}
+
+// IsSystemStream tells whether streamId is written by the event store itself, such as the
+// state of process managers: its name starts with "$". System streams are left out of
+// AllStreams, whose readers expect the events of the application only.
+func IsSystemStream(streamId string) bool {
+	return strings.HasPrefix(streamId, "$")
+}
+
+func isVirtualStream(streamId string) bool {
+	return streamId == AllStreams || strings.HasPrefix(streamId, categoryPrefix)
+}
+
+func streamMatches(subscribed, streamId string) bool {
+	switch {
+	case subscribed == AllStreams:
+		return !IsSystemStream(streamId)
+	case strings.HasPrefix(subscribed, categoryPrefix):
+		return strings.HasPrefix(streamId, strings.TrimPrefix(subscribed, categoryPrefix)+"-")
+	default:
+		return subscribed == streamId
+	}
+}
+
+// streamMayMatch tells whether a stream whose name starts with prefix may match subscribed.
+func streamMayMatch(subscribed, prefix string) bool {
+	switch {
+	case subscribed == AllStreams:
+		return !IsSystemStream(prefix)
+	case strings.HasPrefix(subscribed, categoryPrefix):
+		category := strings.TrimPrefix(subscribed, categoryPrefix) + "-"
+		return strings.HasPrefix(prefix, category) || strings.HasPrefix(category, prefix)
+	default:
+		return strings.HasPrefix(subscribed, prefix)
+	}
+}
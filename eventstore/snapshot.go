@@ -0,0 +1,85 @@
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"github.com/nbarbey/go-event-store/eventstore/codec"
+	"github.com/nbarbey/go-event-store/eventstore/repository"
+)
+
+type SnapshotPolicy interface {
+	ShouldSnapshot(eventsSinceSnapshot int) bool
+}
+
+type SnapshotPolicyFunc func(eventsSinceSnapshot int) bool
+
+func (f SnapshotPolicyFunc) ShouldSnapshot(eventsSinceSnapshot int) bool {
+	return f(eventsSinceSnapshot)
+}
+
+func EveryNEvents(n int) SnapshotPolicy {
+	return SnapshotPolicyFunc(func(eventsSinceSnapshot int) bool {
+		return eventsSinceSnapshot >= n
+	})
+}
+
+type snapshotter[S any] struct {
+	store   repository.SnapshotStore
+	codec   codec.Codec[S]
+	policy  SnapshotPolicy
+	version int
+}
+
+func (s *snapshotter[S]) restore(ctx context.Context, streamId string, state *S, revision *string, position *int64) error {
+	snapshot, err := s.store.LatestSnapshot(ctx, streamId)
+	if errors.Is(err, repository.ErrSnapshotNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if snapshot.SchemaVersion != s.version {
+		// the state has changed shape since: it is rebuilt from the events
+		return nil
+	}
+	*state, err = s.codec.Unmarshall(snapshot.Payload)
+	if err != nil {
+		return err
+	}
+	*revision = snapshot.Revision
+	*position = snapshot.Position
+	return nil
+}
+
+func (s *snapshotter[S]) take(ctx context.Context, streamId string, state S, revision string, position int64) error {
+	payload, err := s.codec.Marshall(state)
+	if err != nil {
+		return err
+	}
+	return s.store.SaveSnapshot(ctx, repository.RawSnapshot{StreamID: streamId, Revision: revision, Position: position, SchemaVersion: s.version, Payload: payload})
+}
+
+// WithSnapshots makes Load start from the latest snapshot of the aggregate and only read
+// the events appended after it. Save takes a new snapshot whenever the policy says so; a
+// snapshot that cannot be taken is tried again on the next Save, as the events are saved.
+func (ar *AggregateRepository[S, E]) WithSnapshots(store repository.SnapshotStore, c codec.Codec[S], policy SnapshotPolicy) *AggregateRepository[S, E] {
+	return &AggregateRepository[S, E]{
+		category:        ar.category,
+		apply:           ar.apply,
+		typeHint:        ar.typeHint,
+		snapshots:       &snapshotter[S]{store: store, codec: c, policy: policy},
+		TypedRepository: ar.TypedRepository,
+	}
+}
+
+// WithSnapshotVersion sets the schema version of the state. Snapshots of other versions are
+// ignored, so that changing the shape of the state only takes bumping its version.
+func (ar *AggregateRepository[S, E]) WithSnapshotVersion(version int) *AggregateRepository[S, E] {
+	out := *ar
+	if ar.snapshots != nil {
+		snapshots := *ar.snapshots
+		snapshots.version = version
+		out.snapshots = &snapshots
+	}
+	return &out
+}
@@ -0,0 +1,246 @@
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"github.com/nbarbey/go-event-store/eventstore/repository"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const subscriptionPageSize = 500
+
+type Subscription struct {
+	cancel context.CancelFunc
+	ctx    context.Context
+
+	// delivery is held by the goroutine catching up with the stream: the publisher's, when
+	// the repository notifies synchronously. Notifications arriving meanwhile set pending,
+	// for the holder to read again rather than wait, as it may be the goroutine notifying.
+	// Subscriptions handing events over to consumers of their own catch up in the
+	// background instead, when signalled on wakeup, so that writers never wait for them.
+	delivery sync.Mutex
+	pending  atomic.Bool
+	wakeup   chan struct{}
+	// delivered is closed once the background delivery has stopped, after Cancel.
+	delivered chan struct{}
+	catchUp   func(ctx context.Context) error
+
+	// state guards the fields below.
+	state    sync.Mutex
+	paused   bool
+	position int64
+
+	stream repository.Repository
+	stats  *subscriptionStats
+}
+
+func newSubscription(stats *subscriptionStats) (*Subscription, context.Context) {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Subscription{cancel: cancel, ctx: ctx, stats: stats}, ctx
+}
+
+// subscribe starts a subscription at the head of the stream. Events are read from the
+// stream by pages of pageSize, from the position of the subscription, whenever the listener
+// is notified, so that events published while paused are delivered on Resume. Consumers
+// record their own stats, as h may only hand events over to them. Read errors and events
+// that cannot be decoded are counted and handed to failed, when not nil: the latter are
+// then skipped, while reading is tried again on the next notification.
+func subscribe[E any](l *Listener[E], pageSize int, stats *subscriptionStats, background bool, h func(ctx context.Context, envelope repository.Envelope[E]) error, failed func(ctx context.Context, err error) error) (*Subscription, error) {
+	subscription, ctx := newSubscription(stats)
+	subscription.stream = l.Repository
+	position, err := l.HeadPosition(ctx)
+	if err != nil {
+		subscription.cancel()
+		return nil, err
+	}
+	subscription.position = position
+	subscription.catchUp = func(ctx context.Context) error {
+		for {
+			subscription.pending.Store(false)
+			from, ok := subscription.next()
+			if !ok {
+				return nil
+			}
+			envelopes, lastPosition, err := l.ReadEnvelopePage(ctx, from, pageSize)
+			var decodeErr *repository.DecodeError
+			if err != nil && !errors.As(err, &decodeErr) {
+				subscription.stats.failed()
+				if failed != nil {
+					err = errors.Join(err, failed(ctx, err))
+				}
+				return err
+			}
+			if lastPosition < from && decodeErr == nil {
+				return nil
+			}
+			for _, envelope := range envelopes {
+				if !subscription.advance(from-1, envelope.Position) {
+					break
+				}
+				if err := h(ctx, envelope); err != nil {
+					return err
+				}
+				from = envelope.Position + 1
+			}
+			if decodeErr != nil && subscription.advance(from-1, decodeErr.Position) {
+				subscription.stats.failed()
+				if failed != nil {
+					if err := failed(ctx, decodeErr); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			subscription.advance(from-1, lastPosition)
+		}
+	}
+
+	if background {
+		subscription.wakeup = make(chan struct{}, 1)
+		subscription.delivered = make(chan struct{})
+		go subscription.deliverInBackground()
+	}
+
+	listener := l.NewListener()
+	listener.Handle(func(context.Context, string) error {
+		return subscription.wake()
+	})
+	if err := listen(ctx, listener); err != nil {
+		subscription.cancel()
+		return nil, err
+	}
+	// events published before the listener took effect were not notified
+	_ = subscription.wake()
+	return subscription, nil
+}
+
+// listen runs listener until ctx is done, and returns once it is listening or has failed.
+func listen(ctx context.Context, listener repository.Listener) error {
+	failed := make(chan error, 1)
+	go func() { failed <- listener.Listen(ctx) }()
+	select {
+	case <-listener.Listening():
+		return nil
+	case err := <-failed:
+		return err
+	}
+}
+
+// wake catches up with the stream, unless another goroutine is already doing so and will
+// read again.
+func (s *Subscription) wake() (err error) {
+	if s.wakeup != nil {
+		select {
+		case s.wakeup <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+	s.pending.Store(true)
+	for s.pending.Load() && s.delivery.TryLock() {
+		err = errors.Join(err, s.catchUp(s.ctx))
+		s.delivery.Unlock()
+	}
+	return err
+}
+
+func (s *Subscription) deliverInBackground() {
+	defer close(s.delivered)
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-s.wakeup:
+		}
+		if s.ctx.Err() != nil {
+			return
+		}
+		s.delivery.Lock()
+		_ = s.catchUp(s.ctx)
+		s.delivery.Unlock()
+	}
+}
+
+// next is the position to read from, unless the subscription is paused.
+func (s *Subscription) next() (int64, bool) {
+	s.state.Lock()
+	defer s.state.Unlock()
+	return s.position + 1, !s.paused
+}
+
+// advance moves the subscription from previous to position, unless it was paused or moved
+// by SeekTo since previous was read.
+func (s *Subscription) advance(previous, position int64) bool {
+	s.state.Lock()
+	defer s.state.Unlock()
+	if s.paused || s.position != previous {
+		return false
+	}
+	s.position = position
+	return true
+}
+
+func (s *Subscription) Cancel() {
+	s.cancel()
+}
+
+// Pause stops delivering events. Events published while paused are read again on Resume.
+func (s *Subscription) Pause() {
+	s.state.Lock()
+	defer s.state.Unlock()
+	s.paused = true
+}
+
+func (s *Subscription) Resume() error {
+	s.state.Lock()
+	s.paused = false
+	s.state.Unlock()
+
+	return s.wake()
+}
+
+// SeekTo makes position the next event to be delivered, rewinding or skipping ahead.
+func (s *Subscription) SeekTo(position int64) error {
+	s.state.Lock()
+	s.position = position - 1
+	s.state.Unlock()
+
+	return s.wake()
+}
+
+func (s *Subscription) Position() int64 {
+	s.state.Lock()
+	defer s.state.Unlock()
+	return s.position
+}
+
+// Metrics reads the head of the subscribed stream to compute how far behind the
+// subscription is. Their position is that of the last event processed, which is behind
+// Position while batch and parallel subscriptions consume the events they fetched.
+func (s *Subscription) Metrics(ctx context.Context) (metrics SubscriptionMetrics, err error) {
+	position := s.Position()
+
+	s.stats.mutex.Lock()
+	metrics.Position = s.stats.processed(position)
+	metrics.Handled = s.stats.handled
+	metrics.Errors = s.stats.errors
+	metrics.Latency = s.stats.latency.clone()
+	s.stats.mutex.Unlock()
+
+	metrics.HeadPosition, err = s.stream.HeadPosition(ctx)
+	if err != nil {
+		return
+	}
+	metrics.LagEvents, err = s.stream.CountRawEvents(ctx, metrics.Position+1)
+	if err != nil || metrics.LagEvents == 0 {
+		return
+	}
+	oldest, err := s.stream.ReadRawEvents(ctx, metrics.Position+1, 1)
+	if err != nil || len(oldest) == 0 {
+		return
+	}
+	metrics.LagSeconds = time.Since(oldest[0].CreatedAt).Seconds()
+	return
+}
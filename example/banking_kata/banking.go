@@ -14,13 +14,7 @@ type Bank struct {
 }
 
 func NewBank(es *eventstore.EventStore[AccountEvent]) *Bank {
-	es.WithCodec(codec.NewJSONCodecWithTypeHints[AccountEvent](codec.NewUnmarshallerMap[AccountEvent]().
-		AddFunc("DepositEvent", func(payload []byte) (event AccountEvent, err error) {
-			return codec.BuildJSONUnmarshalFunc[DepositEvent]()(payload)
-		}).
-		AddFunc("WithdrawEvent", func(payload []byte) (event AccountEvent, err error) {
-			return codec.BuildJSONUnmarshalFunc[WithdrawEvent]()(payload)
-		})))
+	es.WithCodec(codec.NewJSONCodecWithTypeHints[AccountEvent](NewAccountEventUnmarshallerMap()))
 	return &Bank{eventStore: es}
 }
 
@@ -28,6 +22,8 @@ func (b Bank) NewAccount() *Account {
 	return NewAccount(b.eventStore)
 }
 
+//go:generate go run github.com/nbarbey/go-event-store/cmd/eventgen -type AccountEvent
+
 type AccountEvent interface {
 	isAccountEvent()
 }
@@ -85,7 +81,7 @@ func (a Account) PrintStatement() string {
 func (a Account) Withdraw(amount int) {
 	err := a.
 		stream.
-		WithType("WithdrawEvent").
+		WithType(WithdrawEventType).
 		Publish(context.Background(), WithdrawEvent{Amount: amount})
 	if err != nil {
 		panic(err)
@@ -95,7 +91,7 @@ func (a Account) Withdraw(amount int) {
 func (a Account) Deposit(amount int) {
 	err := a.
 		stream.
-		WithType("DepositEvent").
+		WithType(DepositEventType).
 		Publish(context.Background(), DepositEvent{Amount: amount})
 	if err != nil {
 		panic(err)
@@ -19,8 +19,6 @@ func TestAccount_Deposit(t *testing.T) {
 	t.Run("deposit 1", func(t *testing.T) {
 		a := bank.NewAccount()
 
-		time.Sleep(10 * time.Millisecond)
-
 		a.Deposit(1)
 
 		assert.Eventually(t, func() bool { return a.PrintStatement() == "Amount Balance\n+1 1" }, time.Second, time.Millisecond)
@@ -29,8 +27,6 @@ func TestAccount_Deposit(t *testing.T) {
 	t.Run("deposit twice", func(t *testing.T) {
 		a := bank.NewAccount()
 
-		time.Sleep(10 * time.Millisecond)
-
 		a.Deposit(1)
 		a.Deposit(1)
 
@@ -40,8 +36,6 @@ func TestAccount_Deposit(t *testing.T) {
 	t.Run("deposit and withdraw", func(t *testing.T) {
 		a := bank.NewAccount()
 
-		time.Sleep(10 * time.Millisecond)
-
 		a.Deposit(1)
 		a.Withdraw(1)
 